@@ -0,0 +1,1205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/constant"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// service is a struct which has apigen:api methods
+type service struct {
+	Name      string
+	Type      *types.Named
+	Endpoints []*endpoint
+	// Principal is the type returned by Authenticate of the service,
+	// it is set if any endpoint uses the method auth strategy
+	Principal types.Type
+}
+
+// urlMethods returns the methods of the endpoints serving the url in the order
+// they are listed, it is empty if the url is served by an endpoint accepting any method
+func (srv *service) urlMethods(url string) []string {
+	var methods []string
+	for _, ep := range srv.Endpoints {
+		if ep.Spec.URL != url {
+			continue
+		}
+		if len(ep.Spec.Methods) == 0 {
+			return nil
+		}
+		methods = append(methods, ep.Spec.Methods...)
+	}
+
+	return methods
+}
+
+// endpoint is a single apigen:api method of a service
+type endpoint struct {
+	Name string
+	Decl *ast.FuncDecl
+	// Spec is the apigen:api annotation of the method,
+	// empty Spec.Methods means the endpoint accepts any method,
+	// Spec.Auth is the resolved auth strategy with its defaults set
+	Spec *apiSpec
+	// Route is set if the url has placeholders
+	Route *route
+	// Middleware wrap the handler of the endpoint in the order they are listed
+	Middleware []*middleware
+	Params     *params
+	Result     types.Type
+}
+
+// middleware is a func(http.Handler) http.Handler named in the annotation,
+// either a method of the service or a package func
+type middleware struct {
+	Name   string
+	Method bool
+}
+
+// params is the struct an endpoint takes its input in
+type params struct {
+	Type   types.Type
+	Fields []*field
+	// Validate is set if the struct has method Validate() error
+	// which is called after the fields are checked
+	Validate bool
+}
+
+// field is a params struct field filled from the request
+type field struct {
+	// Name is the selector of the field from the params struct,
+	// fields of embedded structs are selected through them, e.g. "Base.Login"
+	Name string
+	// Param is the name of the request parameter the field is filled from
+	Param string
+	// Kind is the name of the basic type underlying Type,
+	// for slices it is the one underlying Elem, for nested structs it is empty
+	Kind string
+	// Type is the type of the field, for pointers it is the type they point to
+	Type  types.Type
+	Ptr   bool
+	Slice bool
+	Elem  types.Type
+	// Fields are the fields of a nested struct
+	Fields []*field
+	Rules  *rules
+	Pos    token.Pos
+	// Default are the Go literals of the default value,
+	// for slices there is a literal for every item
+	Default []string
+	// Validator is the func of the validate rule
+	Validator *validator
+
+	// fields referenced by cross-field rules
+	RequiredIf      *field
+	RequiredWithout *field
+	EqField         *field
+	GtField         *field
+}
+
+// validator is a func of the validate rule
+type validator struct {
+	Name   string
+	Method bool
+	// Elem is set if the validator of a pointer field takes the pointed value,
+	// then it is called only if the value is set
+	Elem bool
+}
+
+// posError is a generator error pointing to the code it was caused by
+type posError struct {
+	Pos token.Position
+	Msg string
+}
+
+func (e posError) Error() string {
+	return e.Pos.String() + ": " + e.Msg
+}
+
+type analyzer struct {
+	fSet     *token.FileSet
+	pkg      *types.Package
+	info     *types.Info
+	typeErrs []types.Error
+	errs     []error
+	// constFiles are the files declaring constants of enums by their names
+	constFiles map[string]*constFile
+}
+
+// analyzePackage type-checks pkg and collects services with their endpoints
+// in the order they are declared in the source
+func analyzePackage(fSet *token.FileSet, pkg *goPackage) (*types.Package, []*service, error) {
+	a := &analyzer{
+		fSet: fSet,
+		info: &types.Info{
+			Defs:  make(map[*ast.Ident]types.Object),
+			Uses:  make(map[*ast.Ident]types.Object),
+			Types: make(map[ast.Expr]types.TypeAndValue),
+		},
+		constFiles: make(map[string]*constFile),
+	}
+
+	conf := types.Config{
+		Importer: newImporter(fSet, pkg.Dir),
+		// the package may use the code we are about to generate,
+		// so type errors are only reported for the types we need
+		Error: func(err error) {
+			if typeErr, ok := err.(types.Error); ok {
+				a.typeErrs = append(a.typeErrs, typeErr)
+			}
+		},
+	}
+	typesPkg, _ := conf.Check(pkg.Path, fSet, pkg.Files, a.info)
+	a.pkg = typesPkg
+
+	var services []*service
+	byName := make(map[string]*service)
+	urls := make(map[string][]*endpoint)
+	auths, srvSpecs := a.serviceAnnotations(pkg)
+
+	for _, file := range pkg.Files {
+		for _, decl := range file.Decls {
+			funcDecl, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			ann := findAnnotation(funcDecl.Doc, apiPrefix)
+			if ann == nil {
+				continue
+			}
+			if funcDecl.Recv == nil {
+				a.errorf(funcDecl.Pos(), "func %s: apigen:api is supported for methods only", funcDecl.Name.Name)
+				continue
+			}
+
+			spec, err := ann.parseSpec()
+			if err != nil {
+				a.annotationErrorf(err, "method %s", funcDecl.Name.Name)
+				continue
+			}
+
+			srvType, ep := a.endpoint(funcDecl, spec)
+			if ep == nil {
+				continue
+			}
+			srvName := srvType.Obj().Name()
+
+			if spec.Errors == "" {
+				spec.Errors = errorModes[0]
+				if srvSpec := srvSpecs[srvName]; srvSpec != nil && srvSpec.Errors != "" {
+					spec.Errors = srvSpec.Errors
+				}
+			}
+
+			if !a.shareURL(srvName, ep, urls[srvName+" "+spec.URL]) {
+				continue
+			}
+			urls[srvName+" "+spec.URL] = append(urls[srvName+" "+spec.URL], ep)
+
+			srv, exists := byName[srvName]
+			if !exists {
+				srv = &service{Name: srvName, Type: srvType}
+				byName[srvName] = srv
+				services = append(services, srv)
+			}
+			if !a.auth(srv, ep, auths[srvName]) || !a.middleware(srv, ep) || !a.validators(srv, ep, ep.Params.Fields) {
+				continue
+			}
+			srv.Endpoints = append(srv.Endpoints, ep)
+		}
+	}
+
+	if len(a.errs) != 0 {
+		return nil, nil, errors.Join(a.errs...)
+	}
+
+	// services are generated in the order their types are declared
+	// and endpoints in the order of their methods, files are parsed
+	// in the order of their names so positions follow the source
+	sort.SliceStable(services, func(i, j int) bool {
+		return services[i].Type.Obj().Pos() < services[j].Type.Obj().Pos()
+	})
+	for _, srv := range services {
+		sort.SliceStable(srv.Endpoints, func(i, j int) bool {
+			return srv.Endpoints[i].Decl.Pos() < srv.Endpoints[j].Decl.Pos()
+		})
+	}
+
+	return typesPkg, services, nil
+}
+
+// shareURL checks that ep can serve the url along with the endpoints
+// of the service already serving it, they must serve different methods,
+// so endpoints accepting any method can't share their url
+func (a *analyzer) shareURL(srvName string, ep *endpoint, shared []*endpoint) bool {
+	for _, other := range shared {
+		if len(ep.Spec.Methods) == 0 || len(other.Spec.Methods) == 0 {
+			a.errorf(ep.Decl.Pos(), "url %s of %s.%s is already used by %s, endpoints sharing a url must list their methods", ep.Spec.URL, srvName, ep.Name, other.Name)
+			return false
+		}
+		for _, method := range ep.Spec.Methods {
+			if contains(other.Spec.Methods, method) {
+				a.errorf(ep.Decl.Pos(), "%s %s of %s.%s is already used by %s", method, ep.Spec.URL, srvName, ep.Name, other.Name)
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// newImporter imports dependencies of the package in dir from the export
+// data the go command builds for them, which is much faster than
+// type-checking them from the source. If the go command can't list the
+// dependencies the source importer is used instead.
+func newImporter(fSet *token.FileSet, dir string) types.Importer {
+	cmd := exec.Command("go", "list", "-e", "-export", "-deps", "-f", "{{.ImportPath}}\t{{.Export}}", ".")
+	cmd.Dir = dir
+	listed, err := cmd.Output()
+	if err != nil {
+		return importer.ForCompiler(fSet, "source", nil)
+	}
+
+	exports := make(map[string]string)
+	for _, line := range strings.Split(string(listed), "\n") {
+		path, export, found := strings.Cut(line, "\t")
+		if found && export != "" {
+			exports[path] = export
+		}
+	}
+
+	return importer.ForCompiler(fSet, "gc", func(path string) (io.ReadCloser, error) {
+		export, exists := exports[path]
+		if !exists {
+			return nil, fmt.Errorf("no export data for %s", path)
+		}
+
+		return os.Open(export)
+	})
+}
+
+func (a *analyzer) errorf(pos token.Pos, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+
+	// the type checker knows better why the type is broken
+	position := a.fSet.Position(pos)
+	for _, typeErr := range a.typeErrs {
+		typeErrPosition := a.fSet.Position(typeErr.Pos)
+		if typeErrPosition.Filename == position.Filename && typeErrPosition.Line == position.Line {
+			msg += ": " + typeErr.Msg
+			break
+		}
+	}
+
+	// fields of a params struct shared by endpoints are analyzed
+	// for each of them, so their errors are reported once
+	err := posError{Pos: position, Msg: msg}
+	for _, reported := range a.errs {
+		if reported == error(err) {
+			return
+		}
+	}
+
+	a.errs = append(a.errs, err)
+}
+
+// serviceAnnotations collects auth strategies of services from apigen:auth
+// annotations and their settings from apigen:service annotations
+func (a *analyzer) serviceAnnotations(pkg *goPackage) (map[string]*authSpec, map[string]*serviceSpec) {
+	auths := make(map[string]*authSpec)
+	specs := make(map[string]*serviceSpec)
+
+	for _, file := range pkg.Files {
+		for _, decl := range file.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok || genDecl.Tok != token.TYPE {
+				continue
+			}
+
+			for _, spec := range genDecl.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				doc := typeSpec.Doc
+				if doc == nil && len(genDecl.Specs) == 1 {
+					doc = genDecl.Doc
+				}
+				name := typeSpec.Name.Name
+
+				if ann := findAnnotation(doc, authPrefix); ann != nil {
+					auth, err := ann.parseAuth()
+					if err != nil {
+						a.annotationErrorf(err, "type %s", name)
+					} else {
+						auths[name] = auth
+					}
+				}
+
+				if ann := findAnnotation(doc, servicePrefix); ann != nil {
+					srvSpec, err := ann.parseService()
+					if err != nil {
+						a.annotationErrorf(err, "type %s", name)
+					} else {
+						specs[name] = srvSpec
+					}
+				}
+			}
+		}
+	}
+
+	return auths, specs
+}
+
+// annotationErrorf reports an annotation error prefixed with what is annotated
+func (a *analyzer) annotationErrorf(err error, format string, args ...interface{}) {
+	annErr := err.(annotationError)
+	a.errorf(annErr.Pos, "%s: %s", fmt.Sprintf(format, args...), annErr.Msg)
+}
+
+// auth resolves the auth strategy of the endpoint, "auth": true selects
+// the one of the service and the token strategy if the service has none
+func (a *analyzer) auth(srv *service, ep *endpoint, srvAuth *authSpec) bool {
+	if ep.Spec.Auth == nil {
+		return true
+	}
+
+	auth := *ep.Spec.Auth
+	if auth.Type == "" {
+		auth = defaultAuth
+		if srvAuth != nil {
+			auth = *srvAuth
+		}
+	}
+	ep.Spec.Auth = auth.withDefaults()
+
+	if auth.Type != "method" {
+		if ep.Spec.Roles != nil || ep.Spec.Scopes != nil {
+			a.errorf(ep.Decl.Pos(), "method %s.%s: roles and scopes require method auth, %s auth principals have none", srv.Name, ep.Name, auth.Type)
+			return false
+		}
+		return true
+	}
+
+	if srv.Principal == nil {
+		principal, err := authenticateResult(srv.Type)
+		if err != nil {
+			a.errorf(ep.Decl.Pos(), "method %s.%s uses method auth: %v", srv.Name, ep.Name, err)
+			return false
+		}
+		srv.Principal = principal
+	}
+
+	for _, check := range []struct {
+		method string
+		values []string
+	}{
+		{"Roles", ep.Spec.Roles},
+		{"Scopes", ep.Spec.Scopes},
+	} {
+		if check.values != nil && !hasListMethod(srv.Principal, check.method) {
+			a.errorf(ep.Decl.Pos(), "method %s.%s: principal %s must have method %s() []string to check %s",
+				srv.Name, ep.Name, srv.Principal, check.method, strings.ToLower(check.method))
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasListMethod reports whether t has the method func() []string
+func hasListMethod(t types.Type, name string) bool {
+	result := types.NewTuple(types.NewVar(token.NoPos, nil, "", types.NewSlice(types.Typ[types.String])))
+	method := types.NewFunc(token.NoPos, nil, name, types.NewSignatureType(nil, nil, nil, nil, result, false))
+	iface := types.NewInterfaceType([]*types.Func{method}, nil).Complete()
+
+	return types.Implements(t, iface)
+}
+
+// middleware resolves the middleware of the endpoint,
+// methods of the service take precedence over package funcs
+func (a *analyzer) middleware(srv *service, ep *endpoint) bool {
+	for _, name := range ep.Spec.Middleware {
+		fn, isMethod := a.lookupFunc(srv, name)
+		if fn == nil {
+			a.errorf(ep.Decl.Pos(), "method %s.%s: middleware %s is neither a method of %s nor a package func", srv.Name, ep.Name, name, srv.Name)
+			return false
+		}
+
+		sig := fn.Type().(*types.Signature)
+		if sig.Params().Len() != 1 || sig.Results().Len() != 1 ||
+			!isHandler(sig.Params().At(0).Type()) || !isHandler(sig.Results().At(0).Type()) {
+			a.errorf(ep.Decl.Pos(), "method %s.%s: middleware %s must have signature func(http.Handler) http.Handler, got %s", srv.Name, ep.Name, name, sig)
+			return false
+		}
+
+		ep.Middleware = append(ep.Middleware, &middleware{
+			Name:   name,
+			Method: isMethod,
+		})
+	}
+
+	return true
+}
+
+// validators resolves the funcs of validate rules of the fields,
+// like middleware they are looked up in the service methods first
+func (a *analyzer) validators(srv *service, ep *endpoint, fields []*field) bool {
+	ok := true
+
+	for _, f := range fields {
+		if f.Fields != nil {
+			ok = a.validators(srv, ep, f.Fields) && ok
+			continue
+		}
+		name := f.Rules.Validate
+		if name == "" {
+			continue
+		}
+
+		fn, isMethod := a.lookupFunc(srv, name)
+		if fn == nil {
+			a.errorf(f.Pos, "field %s: validator %s is neither a method of %s nor a package func", f.Name, name, srv.Name)
+			ok = false
+			continue
+		}
+
+		value := f.Type
+		if f.Ptr {
+			value = types.NewPointer(f.Type)
+		}
+
+		sig := fn.Type().(*types.Signature)
+		if sig.Params().Len() != 2 || sig.Results().Len() != 1 ||
+			!isContext(sig.Params().At(0).Type()) ||
+			!types.Identical(sig.Results().At(0).Type(), types.Universe.Lookup("error").Type()) {
+			a.errorf(f.Pos, "field %s: validator %s must have signature func(context.Context, %s) error, got %s", f.Name, name, a.typeString(value), a.typeString(sig))
+			ok = false
+			continue
+		}
+
+		v := &validator{
+			Name:   name,
+			Method: isMethod,
+		}
+		switch arg := sig.Params().At(1).Type(); {
+		case types.AssignableTo(value, arg):
+		case f.Ptr && types.AssignableTo(f.Type, arg):
+			v.Elem = true
+		default:
+			a.errorf(f.Pos, "field %s: validator %s takes %s, it can't be called with %s", f.Name, name, a.typeString(arg), a.typeString(value))
+			ok = false
+			continue
+		}
+		f.Validator = v
+	}
+
+	return ok
+}
+
+// typeString formats the type for error messages,
+// types of the analyzed package are not qualified
+func (a *analyzer) typeString(t types.Type) string {
+	return types.TypeString(t, types.RelativeTo(a.pkg))
+}
+
+// lookupFunc looks up a method of the service or a package func by name
+// and reports whether it is a method
+func (a *analyzer) lookupFunc(srv *service, name string) (*types.Func, bool) {
+	obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(srv.Type), false, a.pkg, name)
+	if fn, isMethod := obj.(*types.Func); isMethod {
+		return fn, true
+	}
+	fn, _ := a.pkg.Scope().Lookup(name).(*types.Func)
+
+	return fn, false
+}
+
+// authenticateResult checks that the service has the method
+// Authenticate(ctx context.Context, r *http.Request) (Principal, error)
+// and returns the type of the principal
+func authenticateResult(srv *types.Named) (types.Type, error) {
+	obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(srv), false, srv.Obj().Pkg(), "Authenticate")
+	fn, ok := obj.(*types.Func)
+	if !ok {
+		return nil, fmt.Errorf("%s has no method Authenticate", srv.Obj().Name())
+	}
+	sig := fn.Type().(*types.Signature)
+
+	if sig.Params().Len() != 2 || sig.Results().Len() != 2 ||
+		!isContext(sig.Params().At(0).Type()) ||
+		!isRequest(sig.Params().At(1).Type()) ||
+		!types.Identical(sig.Results().At(1).Type(), types.Universe.Lookup("error").Type()) {
+		return nil, fmt.Errorf("%s.Authenticate must have signature func(context.Context, *http.Request) (Principal, error), got %s", srv.Obj().Name(), sig)
+	}
+
+	return sig.Results().At(0).Type(), nil
+}
+
+// endpoint checks the signature of an apigen:api method, it must be
+// func (srv *Service) Method(ctx context.Context, in Params) (Result, error)
+func (a *analyzer) endpoint(decl *ast.FuncDecl, spec *apiSpec) (*types.Named, *endpoint) {
+	fn, ok := a.info.Defs[decl.Name].(*types.Func)
+	if !ok {
+		a.errorf(decl.Pos(), "unresolved method %s", decl.Name.Name)
+		return nil, nil
+	}
+	sig := fn.Type().(*types.Signature)
+
+	recv := sig.Recv().Type()
+	if ptr, ok := recv.(*types.Pointer); ok {
+		recv = ptr.Elem()
+	}
+	named, ok := recv.(*types.Named)
+	if !ok || named.TypeParams().Len() != 0 {
+		a.errorf(decl.Recv.Pos(), "method %s: receiver must be a non-generic named type, got %s", fn.Name(), recv)
+		return nil, nil
+	}
+	srvName := named.Obj().Name()
+
+	if sig.Params().Len() != 2 || sig.Results().Len() != 2 {
+		a.errorf(decl.Type.Pos(), "method %s.%s must have signature func(context.Context, Params) (Result, error)", srvName, fn.Name())
+		return nil, nil
+	}
+
+	ctx := sig.Params().At(0)
+	if !isContext(ctx.Type()) {
+		a.errorf(ctx.Pos(), "method %s.%s: first param must be context.Context, got %s", srvName, fn.Name(), ctx.Type())
+		return nil, nil
+	}
+
+	errResult := sig.Results().At(1)
+	if !types.Identical(errResult.Type(), types.Universe.Lookup("error").Type()) {
+		a.errorf(errResult.Pos(), "method %s.%s: second result must be error, got %s", srvName, fn.Name(), errResult.Type())
+		return nil, nil
+	}
+
+	rt, err := parseRoute(spec.URL)
+	if err != nil {
+		a.errorf(decl.Doc.Pos(), "method %s.%s: %v", srvName, fn.Name(), err)
+		return nil, nil
+	}
+
+	in := sig.Params().At(1)
+	p := a.params(in)
+	if p == nil {
+		return nil, nil
+	}
+
+	for _, f := range p.Fields {
+		if f.Rules.Source == "path" && (rt == nil || !rt.hasParam(f.Param)) {
+			a.errorf(f.Pos, "field %s: url %s of %s.%s has no placeholder {%s}", f.Name, spec.URL, srvName, fn.Name(), f.Param)
+			return nil, nil
+		}
+	}
+
+	return named, &endpoint{
+		Name:   fn.Name(),
+		Decl:   decl,
+		Spec:   spec,
+		Route:  rt,
+		Params: p,
+		Result: sig.Results().At(0).Type(),
+	}
+}
+
+// apiErrorType returns the ApiError type of the package if it has one,
+// it is an error keeping the status of the response in the HTTPStatus field
+func apiErrorType(pkg *types.Package) *types.Named {
+	typeName, ok := pkg.Scope().Lookup("ApiError").(*types.TypeName)
+	if !ok {
+		return nil
+	}
+	named, ok := typeName.Type().(*types.Named)
+	if !ok || named.TypeParams().Len() != 0 {
+		return nil
+	}
+
+	errorType := types.Universe.Lookup("error").Type().Underlying().(*types.Interface)
+	obj, _, _ := types.LookupFieldOrMethod(named, false, pkg, "HTTPStatus")
+	status, isField := obj.(*types.Var)
+	if !isField || !types.Implements(named, errorType) {
+		return nil
+	}
+	if !types.Identical(status.Type(), types.Typ[types.Int]) {
+		return nil
+	}
+
+	return named
+}
+
+func isContext(t types.Type) bool {
+	named, ok := types.Unalias(t).(*types.Named)
+	if !ok || named.Obj().Pkg() == nil {
+		return false
+	}
+
+	return named.Obj().Pkg().Path() == "context" && named.Obj().Name() == "Context"
+}
+
+func isRequest(t types.Type) bool {
+	ptr, ok := types.Unalias(t).(*types.Pointer)
+	if !ok {
+		return false
+	}
+	named, ok := types.Unalias(ptr.Elem()).(*types.Named)
+	if !ok || named.Obj().Pkg() == nil {
+		return false
+	}
+
+	return named.Obj().Pkg().Path() == "net/http" && named.Obj().Name() == "Request"
+}
+
+func isHandler(t types.Type) bool {
+	named, ok := types.Unalias(t).(*types.Named)
+	if !ok || named.Obj().Pkg() == nil {
+		return false
+	}
+
+	return named.Obj().Pkg().Path() == "net/http" && named.Obj().Name() == "Handler"
+}
+
+func (a *analyzer) params(in *types.Var) *params {
+	if !isValid(in.Type()) {
+		a.errorf(in.Pos(), "param %s has unresolved type", in.Name())
+		return nil
+	}
+
+	st, ok := types.Unalias(in.Type()).Underlying().(*types.Struct)
+	if !ok {
+		a.errorf(in.Pos(), "param %s must be a struct, got %s", in.Name(), in.Type())
+		return nil
+	}
+
+	p := &params{
+		Type:   in.Type(),
+		Fields: a.fields(st, "", "", nil),
+	}
+	if !a.crossRefs(p.Fields) {
+		return nil
+	}
+
+	// output is addressable, so methods of the pointer can be called too
+	obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(in.Type()), false, a.pkg, "Validate")
+	if fn, ok := obj.(*types.Func); ok {
+		sig := fn.Type().(*types.Signature)
+		if sig.Params().Len() != 0 || sig.Results().Len() != 1 ||
+			!types.Identical(sig.Results().At(0).Type(), types.Universe.Lookup("error").Type()) {
+			a.errorf(fn.Pos(), "method %s.Validate must have signature func() error, got %s", a.typeString(in.Type()), a.typeString(sig))
+			return nil
+		}
+		p.Validate = true
+	}
+
+	return p
+}
+
+// fields collects fields to fill from the request,
+// fields of embedded structs are collected as if they were declared in st.
+// namePrefix is the selector of st from the params struct
+// and paramPrefix is prepended to the names of request params of its fields,
+// parents are the structs st is nested in
+func (a *analyzer) fields(st *types.Struct, namePrefix, paramPrefix string, parents []*types.Struct) []*field {
+	for _, parent := range parents {
+		if parent == st {
+			return nil
+		}
+	}
+	parents = append(parents, st)
+
+	var fields []*field
+	for i := 0; i < st.NumFields(); i++ {
+		v := st.Field(i)
+		tag := reflect.StructTag(st.Tag(i))
+		name := namePrefix + v.Name()
+
+		if tag.Get("cgen") == "-" {
+			continue
+		}
+
+		if !isValid(v.Type()) {
+			a.errorf(v.Pos(), "field %s has unresolved type", name)
+			continue
+		}
+
+		if v.Embedded() {
+			embedded, ok := types.Unalias(v.Type()).Underlying().(*types.Struct)
+			if ok {
+				fields = append(fields, a.fields(embedded, name+".", paramPrefix, parents)...)
+				continue
+			}
+			if _, isPtr := types.Unalias(v.Type()).Underlying().(*types.Pointer); isPtr {
+				a.errorf(v.Pos(), "embedded pointer field %s is not supported", name)
+				continue
+			}
+		}
+
+		validatorTag, hasValidator := tag.Lookup("apivalidator")
+		_, hasJSON := tag.Lookup("json")
+		if !hasValidator && !hasJSON {
+			continue
+		}
+
+		if !v.Exported() {
+			a.errorf(v.Pos(), "field %s must be exported to be filled from the request", name)
+			continue
+		}
+
+		f := &field{
+			Name: name,
+			Type: v.Type(),
+			Pos:  v.Pos(),
+		}
+
+		var err error
+		f.Rules, err = parseRules(validatorTag)
+		if err != nil {
+			a.errorf(v.Pos(), "field %s: %v", f.Name, err)
+			continue
+		}
+
+		// without paramname the form param is named like the JSON key,
+		// so both encodings of the request take the same names
+		f.Param = f.Rules.ParamName
+		if jsonName, _, _ := strings.Cut(tag.Get("json"), ","); f.Param == "" && jsonName != "" && jsonName != "-" {
+			f.Param = jsonName
+		}
+		if f.Param == "" {
+			f.Param = strings.ToLower(v.Name())
+		}
+		f.Param = paramPrefix + f.Param
+
+		if ptr, ok := types.Unalias(f.Type).Underlying().(*types.Pointer); ok {
+			f.Ptr = true
+			f.Type = ptr.Elem()
+		}
+
+		switch t := types.Unalias(f.Type).Underlying().(type) {
+		case *types.Struct:
+			f.Fields = a.fields(t, f.Name+".", f.Param+".", parents)
+			for _, child := range f.Fields {
+				if child.Rules.Source != "" {
+					a.errorf(child.Pos, "field %s: source is not supported for nested fields", child.Name)
+				}
+			}
+			if f.Fields == nil {
+				a.errorf(v.Pos(), "field %s: nested struct is recursive or has no fields to fill", f.Name)
+				continue
+			}
+		case *types.Slice:
+			f.Slice = true
+			f.Elem = t.Elem()
+			f.Kind = basicName(f.Elem)
+		default:
+			f.Kind = basicName(f.Type)
+		}
+		if f.Kind == "" && f.Fields == nil || f.Slice && f.Ptr {
+			a.errorf(v.Pos(), "field %s has unsupported type %s", f.Name, v.Type())
+			continue
+		}
+
+		if !a.enumValues(f) || !a.checkRules(f) {
+			continue
+		}
+
+		fields = append(fields, f)
+	}
+
+	return fields
+}
+
+// crossRefs resolves the fields referenced by cross-field rules,
+// they must be declared in the same struct as the field with the rule
+func (a *analyzer) crossRefs(fields []*field) bool {
+	ok := true
+
+	lookup := func(f *field, rule, name string) *field {
+		for _, ref := range fields {
+			if ref != f && ref.Name[strings.LastIndex(ref.Name, ".")+1:] == name {
+				return ref
+			}
+		}
+		a.errorf(f.Pos, "field %s: %s references unknown field %s", f.Name, rule, name)
+		ok = false
+		return nil
+	}
+	// canCompare reports whether the fields can be compared by the rule
+	canCompare := func(f, ref *field, rule string) bool {
+		switch {
+		case f.Slice || ref.Slice || ref.Fields != nil:
+			a.errorf(f.Pos, "field %s: %s is not supported for slices and nested structs", f.Name, rule)
+		case !types.Identical(f.Type, ref.Type):
+			a.errorf(f.Pos, "field %s: %s references field %s of another type %s", f.Name, rule, ref.Name, a.typeString(ref.Type))
+		case rule == "gtfield" && f.Kind == "bool":
+			a.errorf(f.Pos, "field %s: gtfield is not supported for bool", f.Name)
+		default:
+			return true
+		}
+		ok = false
+		return false
+	}
+
+	for _, f := range fields {
+		if f.Fields != nil {
+			ok = a.crossRefs(f.Fields) && ok
+			continue
+		}
+		r := f.Rules
+
+		if r.RequiredIf != "" {
+			if ref := lookup(f, "required_if", r.RequiredIf); ref != nil {
+				switch err := checkValue(ref.Kind, r.RequiredIfValue); {
+				case ref.Slice || ref.Fields != nil:
+					a.errorf(f.Pos, "field %s: required_if can't reference slices and nested structs", f.Name)
+					ok = false
+				case err != nil:
+					a.errorf(f.Pos, "field %s: required_if: %v", f.Name, err)
+					ok = false
+				default:
+					f.RequiredIf = ref
+				}
+			}
+		}
+
+		if r.RequiredWithout != "" {
+			if ref := lookup(f, "required_without", r.RequiredWithout); ref != nil {
+				if ref.Fields != nil && !ref.Ptr {
+					a.errorf(f.Pos, "field %s: required_without can't reference nested struct %s, only pointers to them", f.Name, ref.Name)
+					ok = false
+				} else {
+					f.RequiredWithout = ref
+				}
+			}
+		}
+
+		if r.EqField != "" {
+			if ref := lookup(f, "eqfield", r.EqField); ref != nil && canCompare(f, ref, "eqfield") {
+				f.EqField = ref
+			}
+		}
+
+		if r.GtField != "" {
+			if ref := lookup(f, "gtfield", r.GtField); ref != nil && canCompare(f, ref, "gtfield") {
+				f.GtField = ref
+			}
+		}
+	}
+
+	return ok
+}
+
+// enumValues sets the enum of a field typed with a named type to the values
+// of the constants of the type in the order they are declared, values of the enum
+// rule must be among them. Only the constants of a const block declaring
+// nothing but the values of the type are taken, so a single constant like
+// a default value doesn't make an enum. Constants of types of other packages
+// are taken if they are exported, durations are never enums.
+func (a *analyzer) enumValues(f *field) bool {
+	t := f.Type
+	if f.Slice {
+		t = f.Elem
+	}
+	named, ok := types.Unalias(t).(*types.Named)
+	if !ok || named.Obj().Pkg() == nil || isDuration(named) || !isEnumKind(f.Kind) {
+		return true
+	}
+
+	var consts []*types.Const
+	pkg := named.Obj().Pkg()
+	scope := pkg.Scope()
+	isValue := func(name string) bool {
+		c, ok := scope.Lookup(name).(*types.Const)
+		return ok && (pkg == a.pkg || c.Exported()) && types.Identical(c.Type(), named)
+	}
+	for _, name := range scope.Names() {
+		if !isValue(name) {
+			continue
+		}
+		c := scope.Lookup(name).(*types.Const)
+		block := a.constBlock(a.fSet.Position(c.Pos()))
+		if len(block) < 2 {
+			continue
+		}
+		dedicated := true
+		for _, name := range block {
+			dedicated = dedicated && (name == "_" || isValue(name))
+		}
+		if dedicated {
+			consts = append(consts, c)
+		}
+	}
+	if len(consts) == 0 {
+		return true
+	}
+	sort.Slice(consts, func(i, j int) bool {
+		return consts[i].Pos() < consts[j].Pos()
+	})
+
+	var values []string
+	for _, c := range consts {
+		value := c.Val().ExactString()
+		if c.Val().Kind() == constant.String {
+			value = constant.StringVal(c.Val())
+		}
+		// constants may be aliases of the same value
+		if !contains(values, value) {
+			values = append(values, value)
+		}
+	}
+
+	if len(f.Rules.Enum) == 0 {
+		f.Rules.Enum = values
+		return true
+	}
+	for _, value := range f.Rules.Enum {
+		if checkValue(f.Kind, value) == nil && !containsLiteral(f.Kind, values, value) {
+			a.errorf(f.Pos, "field %s: enum value %s is not a constant of %s", f.Name, value, a.typeString(named))
+			return false
+		}
+	}
+
+	return true
+}
+
+// constFile is a parsed file declaring constants
+type constFile struct {
+	fSet *token.FileSet
+	file *ast.File
+}
+
+// constBlock returns the names declared by the parenthesized const declaration
+// at the position, nil if the constant is declared alone. Positions of imported
+// packages have the line only, so the declaration is found by it
+func (a *analyzer) constBlock(pos token.Position) []string {
+	cf, parsed := a.constFiles[pos.Filename]
+	if !parsed {
+		fileName := strings.Replace(pos.Filename, "$GOROOT", build.Default.GOROOT, 1)
+		cf = &constFile{fSet: token.NewFileSet()}
+		// without the source no constants make an enum
+		cf.file, _ = parser.ParseFile(cf.fSet, fileName, nil, parser.SkipObjectResolution)
+		a.constFiles[pos.Filename] = cf
+	}
+	if cf.file == nil {
+		return nil
+	}
+
+	for _, decl := range cf.file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.CONST || !genDecl.Lparen.IsValid() {
+			continue
+		}
+		if pos.Line < cf.fSet.Position(genDecl.Lparen).Line || pos.Line > cf.fSet.Position(genDecl.Rparen).Line {
+			continue
+		}
+
+		var names []string
+		for _, spec := range genDecl.Specs {
+			for _, name := range spec.(*ast.ValueSpec).Names {
+				names = append(names, name.Name)
+			}
+		}
+		return names
+	}
+
+	return nil
+}
+
+func isEnumKind(kind string) bool {
+	switch kinds[kind].Parser {
+	case "", "ParseInt", "ParseUint":
+		return kind != ""
+	}
+
+	return false
+}
+
+// containsLiteral reports whether the value is in the list
+// comparing them as literals of the kind, so 010 matches 10
+func containsLiteral(kind string, list []string, value string) bool {
+	for _, item := range list {
+		if literal(kind, item) == literal(kind, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkRules reports rules which can't be applied to the field
+func (a *analyzer) checkRules(f *field) bool {
+	if f.Fields != nil {
+		allowed := rules{
+			Required:  f.Rules.Required,
+			ParamName: f.Rules.ParamName,
+		}
+		if !reflect.DeepEqual(*f.Rules, allowed) {
+			a.errorf(f.Pos, "field %s: only required and paramname are supported for nested structs", f.Name)
+			return false
+		}
+		if f.Rules.Required && !f.Ptr {
+			a.errorf(f.Pos, "field %s: required is supported for nested struct pointers only", f.Name)
+			return false
+		}
+		return true
+	}
+
+	ok := true
+
+	for _, bound := range []string{f.Rules.Min, f.Rules.Max} {
+		if err := checkBound(f.Kind, bound); err != nil {
+			a.errorf(f.Pos, "field %s: %v", f.Name, err)
+			ok = false
+		}
+	}
+
+	switch {
+	case f.Rules.Source == "":
+	case f.Rules.Source != "path":
+		a.errorf(f.Pos, "field %s: unknown source %s", f.Name, f.Rules.Source)
+		ok = false
+	case f.Ptr || f.Slice:
+		a.errorf(f.Pos, "field %s: path params can't be pointers or slices", f.Name)
+		ok = false
+	}
+
+	if len(f.Rules.Enum) != 0 {
+		if !isEnumKind(f.Kind) {
+			a.errorf(f.Pos, "field %s: enum is supported for strings and integers only", f.Name)
+			return false
+		}
+		for _, value := range f.Rules.Enum {
+			if err := checkValue(f.Kind, value); err != nil {
+				a.errorf(f.Pos, "field %s: enum %v", f.Name, err)
+				return false
+			}
+		}
+	}
+
+	if f.Rules.Default != "" {
+		var err error
+		f.Default, err = defaultValue(f)
+		if err != nil {
+			a.errorf(f.Pos, "field %s: default %v", f.Name, err)
+			ok = false
+		}
+	}
+
+	if !f.Slice && (f.Rules.MinItems != "" || f.Rules.MaxItems != "" || f.Rules.Unique || f.Rules.CSV) {
+		a.errorf(f.Pos, "field %s: minItems, maxItems, unique and csv are supported for slices only", f.Name)
+		ok = false
+	}
+
+	hasStringRules := f.Rules.Pattern != "" || f.Rules.Format != "" || f.Rules.Trim || f.Rules.Lowercase
+	if hasStringRules && f.Kind != "string" {
+		a.errorf(f.Pos, "field %s: pattern, format, trim and lowercase are supported for strings only", f.Name)
+		ok = false
+	}
+
+	if f.Rules.Format != "" && !contains(formats, f.Rules.Format) {
+		a.errorf(f.Pos, "field %s: unknown format %s, it must be one of %s", f.Name, f.Rules.Format, strings.Join(formats, ", "))
+		ok = false
+	}
+
+	if f.Rules.Pattern != "" {
+		if _, err := regexp.Compile(f.Rules.Pattern); err != nil {
+			a.errorf(f.Pos, "field %s: bad pattern: %v", f.Name, err)
+			ok = false
+		}
+	}
+
+	for _, bound := range []string{f.Rules.MinItems, f.Rules.MaxItems} {
+		if err := checkBound("string", bound); err != nil {
+			a.errorf(f.Pos, "field %s: %s is not a valid items count", f.Name, bound)
+			ok = false
+		}
+	}
+
+	return ok
+}
+
+// defaultValue checks the default of the field and returns its literals,
+// items of a slice are separated with | like the values of enum
+// and durations are written like 1m30s
+func defaultValue(f *field) ([]string, error) {
+	values := []string{f.Rules.Default}
+	t := f.Type
+	if f.Slice {
+		values = strings.Split(f.Rules.Default, "|")
+		t = f.Elem
+	}
+
+	var literals []string
+	for _, value := range values {
+		if len(f.Rules.Enum) != 0 && !containsLiteral(f.Kind, f.Rules.Enum, value) {
+			return nil, fmt.Errorf("%s is not one of enum values", value)
+		}
+
+		if isDuration(t) {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s is not a valid duration", value)
+			}
+			literals = append(literals, strconv.FormatInt(int64(d), 10))
+			continue
+		}
+
+		if err := checkValue(f.Kind, value); err != nil {
+			return nil, err
+		}
+		literals = append(literals, literal(f.Kind, value))
+	}
+
+	return literals, nil
+}
+
+// isDurationField reports whether the values of the field are durations,
+// they are sent in the form like 1m30s
+func isDurationField(f *field) bool {
+	if f.Slice {
+		return isDuration(f.Elem)
+	}
+
+	return isDuration(f.Type)
+}
+
+func isDuration(t types.Type) bool {
+	named, ok := types.Unalias(t).(*types.Named)
+	if !ok || named.Obj().Pkg() == nil {
+		return false
+	}
+
+	return named.Obj().Pkg().Path() == "time" && named.Obj().Name() == "Duration"
+}
+
+func isValid(t types.Type) bool {
+	return types.Unalias(t) != types.Typ[types.Invalid]
+}
+
+// basicName returns the name of the basic type underlying t
+// if it is supported by the generator, otherwise an empty string
+func basicName(t types.Type) string {
+	basic, ok := types.Unalias(t).Underlying().(*types.Basic)
+	if !ok {
+		return ""
+	}
+
+	// byte and rune are named by the types they are aliases for
+	name := types.Typ[basic.Kind()].Name()
+	if _, supported := kinds[name]; !supported {
+		return ""
+	}
+
+	return name
+}
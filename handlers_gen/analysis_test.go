@@ -0,0 +1,176 @@
+package main
+
+import (
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// analyzeSource analyzes the package with the single file of src
+func analyzeSource(t *testing.T, src string) ([]*service, error) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "api.go")
+	if err := os.WriteFile(fileName, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fSet := token.NewFileSet()
+	pkg, err := loadPackage(fSet, fileName, filepath.Join(dir, "api_handlers.go"))
+	if err != nil {
+		t.Fatalf("load error: %v", err)
+	}
+	_, services, err := analyzePackage(fSet, pkg)
+
+	return services, err
+}
+
+func TestSharedParamsErrors(t *testing.T) {
+	_, err := analyzeSource(t, `package api
+
+import "context"
+
+type Params struct {
+	a int `+"`apivalidator:\"required\"`"+`
+}
+
+type Api struct{}
+
+// apigen:api {"url": "/a"}
+func (srv *Api) A(ctx context.Context, in Params) (int, error) { return 0, nil }
+
+// apigen:api {"url": "/b"}
+func (srv *Api) B(ctx context.Context, in Params) (int, error) { return 0, nil }
+`)
+	if err == nil {
+		t.Fatal("expected an error of the unexported field")
+	}
+	if count := strings.Count(err.Error(), "field a must be exported to be filled from the request"); count != 1 {
+		t.Errorf("expected the error once, got %d times:\n%v", count, err)
+	}
+}
+
+func TestSharedURL(t *testing.T) {
+	cases := []struct {
+		Methods  [2]string
+		Expected string
+	}{
+		{[2]string{`"GET"`, `"DELETE"`}, ""},
+		{[2]string{`["GET", "POST"]`, `"POST"`}, "POST /item of Api.B is already used by A"},
+		{[2]string{`"GET"`, `[]`}, "url /item of Api.B is already used by A, endpoints sharing a url must list their methods"},
+	}
+
+	for _, item := range cases {
+		services, err := analyzeSource(t, `package api
+
+import "context"
+
+type Api struct{}
+
+// apigen:api {"url": "/item", "auth": false, "method": `+item.Methods[0]+`}
+func (srv *Api) A(ctx context.Context, in struct{}) (int, error) { return 0, nil }
+
+// apigen:api {"url": "/item", "auth": false, "method": `+item.Methods[1]+`}
+func (srv *Api) B(ctx context.Context, in struct{}) (int, error) { return 0, nil }
+`)
+		switch {
+		case item.Expected == "" && err != nil:
+			t.Errorf("[%v] unexpected error: %v", item.Methods, err)
+		case item.Expected == "":
+			if got := services[0].urlMethods("/item"); strings.Join(got, ", ") != "GET, DELETE" {
+				t.Errorf("[%v] expected methods GET, DELETE, got %v", item.Methods, got)
+			}
+		case err == nil || !strings.Contains(err.Error(), item.Expected):
+			t.Errorf("[%v] expected error %q, got %v", item.Methods, item.Expected, err)
+		}
+	}
+}
+
+func TestImportedEnum(t *testing.T) {
+	services, err := analyzeSource(t, `package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+type Params struct {
+	Mode http.SameSite `+"`apivalidator:\"\"`"+`
+	Wait time.Duration `+"`apivalidator:\"\"`"+`
+}
+
+type Api struct{}
+
+// apigen:api {"url": "/a"}
+func (srv *Api) A(ctx context.Context, in Params) (int, error) { return 0, nil }
+`)
+	if err != nil {
+		t.Fatalf("analysis error: %v", err)
+	}
+
+	fields := services[0].Endpoints[0].Params.Fields
+	if got := strings.Join(fields[0].Rules.Enum, ", "); got != "1, 2, 3, 4" {
+		t.Errorf("expected the constants of http.SameSite, got %q", got)
+	}
+	if fields[1].Rules.Enum != nil {
+		t.Errorf("expected no enum of time.Duration, got %v", fields[1].Rules.Enum)
+	}
+}
+
+func TestEnumBlock(t *testing.T) {
+	services, err := analyzeSource(t, `package api
+
+import "context"
+
+type Limit int
+
+const DefaultLimit Limit = 20
+
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleAdmin Role = "admin"
+)
+
+const (
+	DefaultRole Role = "user"
+	MaxItems         = 10
+)
+
+type Level int
+
+const (
+	LevelLow Level = iota + 1
+	_
+	LevelHigh
+)
+
+type Params struct {
+	Limit Limit `+"`apivalidator:\"default=20\"`"+`
+	Role  Role  `+"`apivalidator:\"\"`"+`
+	Level Level `+"`apivalidator:\"\"`"+`
+}
+
+type Api struct{}
+
+// apigen:api {"url": "/a"}
+func (srv *Api) A(ctx context.Context, in Params) (int, error) { return 0, nil }
+`)
+	if err != nil {
+		t.Fatalf("analysis error: %v", err)
+	}
+
+	fields := services[0].Endpoints[0].Params.Fields
+	if fields[0].Rules.Enum != nil {
+		t.Errorf("expected no enum of a single constant, got %v", fields[0].Rules.Enum)
+	}
+	if got := strings.Join(fields[1].Rules.Enum, ", "); got != "user, admin" {
+		t.Errorf("expected the constants of the Role block, got %q", got)
+	}
+	if got := strings.Join(fields[2].Rules.Enum, ", "); got != "1, 3" {
+		t.Errorf("expected the constants of the Level block, got %q", got)
+	}
+}
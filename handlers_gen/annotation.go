@@ -0,0 +1,491 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	apiPrefix     = "apigen:api"
+	authPrefix    = "apigen:auth"
+	servicePrefix = "apigen:service"
+)
+
+// apiSpec is the decoded apigen:api annotation of a method:
+//
+//	// apigen:api {"url": "/user/create", "auth": true, "method": "POST"}
+//
+// url is required, method is either a single method or an array of them
+// and allows any by default. auth is false by default, true means the strategy
+// of the service, an object like {"type": "bearer"} selects the one of the method.
+// Authenticated principals may be required to have any of roles
+// and all of scopes, e.g. "roles": ["admin", "moderator"].
+// middleware lists methods of the service or package funcs
+// of type func(http.Handler) http.Handler wrapping the handler.
+// errors is either "first" to reply with the first validation error
+// or "all" to reply with the errors of all fields, the one of the service by default
+type apiSpec struct {
+	URL        string
+	Auth       *authSpec
+	Methods    []string
+	Roles      []string
+	Scopes     []string
+	Middleware []string
+	Errors     string
+}
+
+// serviceSpec are the settings of all methods of a service
+// given in an apigen:service annotation on the struct:
+//
+//	// apigen:service {"errors": "all"}
+type serviceSpec struct {
+	Errors string
+}
+
+// errorModes are the values of "errors", the first one is the default
+var errorModes = []string{"first", "all"}
+
+// authSpec is an auth strategy, services select the default one
+// for their methods with an apigen:auth annotation on the struct:
+//
+//	// apigen:auth {"type": "apikey", "query": "key", "env": "API_KEY"}
+//
+// static credentials are compared with the value of the env variable,
+// for basic it is user:password, method calls Authenticate of the service
+type authSpec struct {
+	Type   string
+	Header string
+	Query  string
+	Env    string
+}
+
+// authTypes are the auth strategies with their default settings
+var authTypes = map[string]authSpec{
+	"token":  {Header: "X-Auth", Env: "API_AUTH_TOKEN"},
+	"bearer": {Env: "API_AUTH_TOKEN"},
+	"basic":  {Env: "API_AUTH_BASIC"},
+	"apikey": {Header: "X-Api-Key", Env: "API_AUTH_KEY"},
+	"method": {},
+}
+
+// defaultAuth is the strategy of services without apigen:auth
+var defaultAuth = authSpec{Type: "token"}
+
+// httpMethods are the methods an endpoint may be restricted to,
+// endpoints without "method" accept all of them
+var httpMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+// annotationError is an error in the annotation pointing to the part it was caused by
+type annotationError struct {
+	Pos token.Pos
+	Msg string
+}
+
+func (e annotationError) Error() string {
+	return e.Msg
+}
+
+// annotation is the JSON of the apigen:api annotation, it may continue
+// on the following lines of the comment, so the position of every byte is kept
+type annotation struct {
+	src []byte
+	pos []token.Pos
+	end token.Pos
+
+	// the state of the scan finding the closing brace of the object
+	depth    int
+	inString bool
+	escaped  bool
+	closed   bool
+}
+
+// findAnnotation returns the annotation with the prefix from the doc comment,
+// nil if there is none. The annotation ends with the line closing its object
+// or before a blank line, the doc text after it isn't a part of it
+func findAnnotation(doc *ast.CommentGroup, prefix string) *annotation {
+	if doc == nil {
+		return nil
+	}
+
+	var a *annotation
+	for _, comment := range doc.List {
+		text, offset := commentText(comment)
+
+		if a == nil {
+			trimmed := strings.TrimLeft(text, " \t")
+			if !strings.HasPrefix(trimmed, prefix+" ") && !strings.HasPrefix(trimmed, prefix+"{") && trimmed != prefix {
+				continue
+			}
+			skip := len(text) - len(trimmed) + len(prefix)
+			text, offset = text[skip:], offset+skip
+			a = &annotation{}
+		} else {
+			if strings.TrimSpace(text) == "" {
+				break
+			}
+			a.src = append(a.src, '\n')
+			a.pos = append(a.pos, comment.Pos())
+		}
+
+		for i := range text {
+			a.src = append(a.src, text[i])
+			a.pos = append(a.pos, comment.Pos()+token.Pos(offset+i))
+			a.scan(text[i])
+		}
+		a.end = comment.End()
+
+		if a.closed {
+			break
+		}
+	}
+
+	return a
+}
+
+// scan follows the nesting of the JSON by its next byte,
+// the object is closed by the brace balancing the first one
+func (a *annotation) scan(c byte) {
+	switch {
+	case a.escaped:
+		a.escaped = false
+	case a.inString:
+		a.escaped = c == '\\'
+		a.inString = c != '"'
+	case c == '"':
+		a.inString = true
+	case c == '{' || c == '[':
+		a.depth++
+	case c == '}' || c == ']':
+		a.depth--
+		a.closed = a.closed || a.depth == 0
+	}
+}
+
+// commentText strips comment markers and returns the offset of the text in the comment
+func commentText(comment *ast.Comment) (string, int) {
+	if strings.HasPrefix(comment.Text, "/*") {
+		return strings.TrimSuffix(comment.Text[2:], "*/"), 2
+	}
+
+	return comment.Text[2:], 2
+}
+
+func (a *annotation) posAt(offset int64) token.Pos {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= int64(len(a.pos)) {
+		return a.end
+	}
+
+	return a.pos[offset]
+}
+
+// skipSpace returns the offset of the first byte which is not a JSON whitespace
+// or one of the separators starting from offset
+func (a *annotation) skipSpace(offset int64, separators string) int64 {
+	for offset < int64(len(a.src)) && strings.IndexByte(" \t\r\n"+separators, a.src[offset]) != -1 {
+		offset++
+	}
+
+	return offset
+}
+
+func (a *annotation) errorf(offset int64, format string, args ...interface{}) error {
+	return annotationError{
+		Pos: a.posAt(offset),
+		Msg: fmt.Sprintf(format, args...),
+	}
+}
+
+// syntaxError converts an error of the JSON decoder into the annotation error
+func (a *annotation) syntaxError(dec *json.Decoder, err error) error {
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return a.errorf(syntaxErr.Offset-1, "bad annotation: %v", err)
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return a.errorf(int64(len(a.src)), "bad annotation: unexpected end of JSON")
+	}
+
+	return a.errorf(dec.InputOffset(), "bad annotation: %v", err)
+}
+
+// decode decodes the JSON object of the annotation passing its keys to set,
+// which returns false for unknown keys. Keys found in the object are returned
+func (a *annotation) decode(set func(key string, value json.RawMessage) (bool, error)) (map[string]bool, error) {
+	dec := json.NewDecoder(bytes.NewReader(a.src))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, a.syntaxError(dec, err)
+	}
+	if tok != json.Delim('{') {
+		return nil, a.errorf(a.skipSpace(0, ""), "annotation must be a JSON object")
+	}
+
+	seen := make(map[string]bool)
+	for dec.More() {
+		keyOffset := a.skipSpace(dec.InputOffset(), ",")
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, a.syntaxError(dec, err)
+		}
+		key := tok.(string)
+
+		valueOffset := a.skipSpace(dec.InputOffset(), ":")
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, a.syntaxError(dec, err)
+		}
+
+		if seen[key] {
+			return nil, a.errorf(keyOffset, "duplicate key %q", key)
+		}
+		seen[key] = true
+
+		known, err := set(key, value)
+		if !known {
+			return nil, a.errorf(keyOffset, "unknown key %q", key)
+		}
+		if err != nil {
+			return nil, a.errorf(valueOffset, "%s: %v", key, err)
+		}
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return nil, a.syntaxError(dec, err)
+	}
+	if rest := a.skipSpace(dec.InputOffset(), ""); rest != int64(len(a.src)) {
+		return nil, a.errorf(rest, "unexpected text after annotation")
+	}
+
+	return seen, nil
+}
+
+// parseSpec decodes the apigen:api annotation
+func (a *annotation) parseSpec() (*apiSpec, error) {
+	spec := &apiSpec{}
+	seen, err := a.decode(spec.set)
+	if err != nil {
+		return nil, err
+	}
+
+	if !seen["url"] {
+		return nil, a.errorf(a.skipSpace(0, ""), "url is required")
+	}
+	if (spec.Roles != nil || spec.Scopes != nil) && spec.Auth == nil {
+		return nil, a.errorf(a.skipSpace(0, ""), "roles and scopes require auth")
+	}
+
+	return spec, nil
+}
+
+// parseService decodes the apigen:service annotation
+func (a *annotation) parseService() (*serviceSpec, error) {
+	spec := &serviceSpec{}
+	if _, err := a.decode(spec.set); err != nil {
+		return nil, err
+	}
+
+	return spec, nil
+}
+
+// parseAuth decodes the apigen:auth annotation
+func (a *annotation) parseAuth() (*authSpec, error) {
+	auth := &authSpec{}
+	if _, err := a.decode(auth.set); err != nil {
+		return nil, err
+	}
+
+	if err := auth.check(); err != nil {
+		return nil, a.errorf(a.skipSpace(0, ""), "%v", err)
+	}
+
+	return auth, nil
+}
+
+// set decodes the value of the key into spec, false is returned for unknown keys
+func (spec *apiSpec) set(key string, value json.RawMessage) (bool, error) {
+	switch key {
+	case "url":
+		if err := json.Unmarshal(value, &spec.URL); err != nil {
+			return true, errors.New("must be a string")
+		}
+		if !strings.HasPrefix(spec.URL, "/") {
+			return true, fmt.Errorf("%q must start with /", spec.URL)
+		}
+	case "auth":
+		var enabled bool
+		if err := json.Unmarshal(value, &enabled); err == nil {
+			spec.Auth = nil
+			if enabled {
+				spec.Auth = &authSpec{}
+			}
+			return true, nil
+		}
+
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(value, &object); err != nil {
+			return true, errors.New("must be a boolean or an object")
+		}
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		spec.Auth = &authSpec{}
+		for _, key := range keys {
+			known, err := spec.Auth.set(key, object[key])
+			if !known {
+				return true, fmt.Errorf("unknown key %q", key)
+			}
+			if err != nil {
+				return true, fmt.Errorf("%s: %v", key, err)
+			}
+		}
+		return true, spec.Auth.check()
+	case "method":
+		if err := json.Unmarshal(value, &spec.Methods); err != nil {
+			var method string
+			if err := json.Unmarshal(value, &method); err != nil {
+				return true, errors.New("must be a string or an array of strings")
+			}
+			spec.Methods = []string{method}
+		}
+		for _, method := range spec.Methods {
+			if !contains(httpMethods, method) {
+				return true, fmt.Errorf("unknown method %q", method)
+			}
+		}
+	case "roles", "scopes":
+		var list []string
+		if err := json.Unmarshal(value, &list); err != nil || len(list) == 0 || contains(list, "") {
+			return true, errors.New("must be a non-empty array of non-empty strings")
+		}
+		if key == "roles" {
+			spec.Roles = list
+		} else {
+			spec.Scopes = list
+		}
+	case "errors":
+		return true, decodeErrorMode(value, &spec.Errors)
+	case "middleware":
+		if err := json.Unmarshal(value, &spec.Middleware); err != nil {
+			return true, errors.New("must be an array of names")
+		}
+		for _, name := range spec.Middleware {
+			if !token.IsIdentifier(name) {
+				return true, fmt.Errorf("%q is not a valid name", name)
+			}
+		}
+	default:
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// set decodes the value of the key into spec, false is returned for unknown keys
+func (spec *serviceSpec) set(key string, value json.RawMessage) (bool, error) {
+	if key != "errors" {
+		return false, nil
+	}
+
+	return true, decodeErrorMode(value, &spec.Errors)
+}
+
+func decodeErrorMode(value json.RawMessage, mode *string) error {
+	if err := json.Unmarshal(value, mode); err != nil || !contains(errorModes, *mode) {
+		return fmt.Errorf("must be one of %s", strings.Join(errorModes, ", "))
+	}
+
+	return nil
+}
+
+// set decodes the value of the key into auth, false is returned for unknown keys
+func (auth *authSpec) set(key string, value json.RawMessage) (bool, error) {
+	var dst *string
+	switch key {
+	case "type":
+		dst = &auth.Type
+	case "header":
+		dst = &auth.Header
+	case "query":
+		dst = &auth.Query
+	case "env":
+		dst = &auth.Env
+	default:
+		return false, nil
+	}
+
+	if err := json.Unmarshal(value, dst); err != nil || *dst == "" {
+		return true, errors.New("must be a non-empty string")
+	}
+	if key == "type" {
+		if _, known := authTypes[auth.Type]; !known {
+			return true, fmt.Errorf("unknown auth type %q", auth.Type)
+		}
+	}
+
+	return true, nil
+}
+
+// check reports settings the strategy doesn't have
+func (auth *authSpec) check() error {
+	if auth.Type == "" {
+		return errors.New("auth type is required")
+	}
+
+	switch {
+	case auth.Header != "" && auth.Type != "token" && auth.Type != "apikey":
+		return fmt.Errorf("header is not supported by %s auth", auth.Type)
+	case auth.Query != "" && auth.Type != "apikey":
+		return fmt.Errorf("query is not supported by %s auth", auth.Type)
+	case auth.Header != "" && auth.Query != "":
+		return errors.New("api key is sent either in header or in query")
+	case auth.Env != "" && auth.Type == "method":
+		return errors.New("env is not supported by method auth")
+	}
+
+	return nil
+}
+
+// withDefaults returns the strategy with the settings
+// which are not given set to their defaults
+func (auth authSpec) withDefaults() *authSpec {
+	dflt := authTypes[auth.Type]
+	if auth.Header == "" && auth.Query == "" {
+		auth.Header = dflt.Header
+	}
+	if auth.Env == "" {
+		auth.Env = dflt.Env
+	}
+
+	return &auth
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"testing"
+)
+
+func TestParseAnnotation(t *testing.T) {
+	cases := []struct {
+		Doc  string
+		Spec *apiSpec
+		// Err is the position of the error, line:column
+		Err string
+	}{
+		{
+			Doc:  `// apigen:api {"url": "/user/profile"}`,
+			Spec: &apiSpec{URL: "/user/profile"},
+		},
+		{
+			Doc:  `// apigen:api {"url": "/user/create", "auth": true, "method": "POST"}`,
+			Spec: &apiSpec{URL: "/user/create", Auth: &authSpec{}, Methods: []string{"POST"}},
+		},
+		{
+			Doc:  `// apigen:api {"url": "/user", "auth": {"type": "apikey", "query": "key"}}`,
+			Spec: &apiSpec{URL: "/user", Auth: &authSpec{Type: "apikey", Query: "key"}},
+		},
+		{
+			Doc: `// apigen:api {"url": "/user", "auth": {"type": "bearer", "header": "X-Token"}}`,
+			Err: "1:40",
+		},
+		{
+			Doc:  `// apigen:api {"url": "/user", "auth": true, "roles": ["admin", "moderator"], "scopes": ["write"]}`,
+			Spec: &apiSpec{URL: "/user", Auth: &authSpec{}, Roles: []string{"admin", "moderator"}, Scopes: []string{"write"}},
+		},
+		{
+			Doc:  `// apigen:api {"url": "/user", "middleware": ["logRequest", "RateLimit"]}`,
+			Spec: &apiSpec{URL: "/user", Middleware: []string{"logRequest", "RateLimit"}},
+		},
+		{
+			Doc: `// apigen:api {"url": "/user", "middleware": ["srv.RateLimit"]}`,
+			Err: "1:46",
+		},
+		{
+			Doc:  `// apigen:api {"url": "/user", "errors": "all"}`,
+			Spec: &apiSpec{URL: "/user", Errors: "all"},
+		},
+		{
+			Doc: `// apigen:api {"url": "/user", "errors": "some"}`,
+			Err: "1:42",
+		},
+		{
+			Doc: `// apigen:api {"url": "/user", "roles": ["admin"]}`,
+			Err: "1:15",
+		},
+		{
+			Doc: `// apigen:api {"url": "/user", "auth": true, "roles": []}`,
+			Err: "1:55",
+		},
+		{
+			Doc: `// apigen:api {"url": "/user", "auth": {"type": "jwt"}}`,
+			Err: "1:40",
+		},
+		{
+			Doc:  "// Profile returns the user.\n// apigen:api {\"url\": \"/user\",\n//   \"method\": [\"GET\", \"HEAD\"]}",
+			Spec: &apiSpec{URL: "/user", Methods: []string{"GET", "HEAD"}},
+		},
+		{
+			Doc: `// Profile returns the user.`,
+		},
+		{ // the doc text after the annotation isn't a part of it
+			Doc:  "// apigen:api {\"url\": \"/user\",\n//   \"method\": \"GET\"}\n// Profile returns the user {or nobody}.",
+			Spec: &apiSpec{URL: "/user", Methods: []string{"GET"}},
+		},
+		{
+			Doc:  "// apigen:api {\"url\": \"/user/{id}\"}\n//\n// Profile returns the user.",
+			Spec: &apiSpec{URL: "/user/{id}"},
+		},
+		{
+			Doc: "// apigen:api {\"url\": \"/user\",\n//\n// \"method\": \"GET\"}",
+			Err: "1:30",
+		},
+		{
+			Doc: `// apigen:api {"url": "/user", "auht": true}`,
+			Err: "1:32",
+		},
+		{
+			Doc: "// apigen:api {\"url\": \"/user\",\n// \"method\": [\"GET\", \"PUTT\"]}",
+			Err: "2:14",
+		},
+		{
+			Doc: `// apigen:api {"url": "/user", "auth": tru}`,
+			Err: "1:43",
+		},
+		{
+			Doc: `// apigen:api {"url": "/user", "auth": "yes"}`,
+			Err: "1:40",
+		},
+		{
+			Doc: `// apigen:api {"auth": true}`,
+			Err: "1:15",
+		},
+		{
+			Doc: `// apigen:api {"url": "user"}`,
+			Err: "1:23",
+		},
+		{
+			Doc: `// apigen:api {"url": "/user", "url": "/admin"}`,
+			Err: "1:32",
+		},
+		{
+			Doc: `// apigen:api {"url": "/user"`,
+			Err: "1:29",
+		},
+	}
+
+	for _, item := range cases {
+		fSet := token.NewFileSet()
+		file, err := parser.ParseFile(fSet, "api.go", "package api\n"+item.Doc+"\nfunc f() {}", parser.ParseComments)
+		if err != nil {
+			t.Fatalf("[%s] bad source: %v", item.Doc, err)
+		}
+		doc := file.Decls[0].(*ast.FuncDecl).Doc
+
+		ann := findAnnotation(doc, apiPrefix)
+		if ann == nil {
+			if item.Spec != nil || item.Err != "" {
+				t.Errorf("[%s] annotation not found", item.Doc)
+			}
+			continue
+		}
+
+		spec, err := ann.parseSpec()
+		if item.Err != "" {
+			annErr, ok := err.(annotationError)
+			if !ok {
+				t.Errorf("[%s] expected error, got spec %+v", item.Doc, spec)
+				continue
+			}
+			// the source starts with the package clause
+			pos := fSet.Position(annErr.Pos)
+			pos.Line--
+			if got := pos.String(); got != "api.go:"+item.Err {
+				t.Errorf("[%s] error %q is at %s, expected %s", item.Doc, annErr.Msg, got, item.Err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%s] unexpected error: %v", item.Doc, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(spec, item.Spec) {
+			t.Errorf("[%s] specs not match\nGot: %+v\nExpected: %+v", item.Doc, spec, item.Spec)
+		}
+	}
+}
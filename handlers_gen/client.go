@@ -0,0 +1,409 @@
+package main
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+var (
+	clientTpl = template.Must(template.New("clientTpl").Parse(`
+// {{.StructName}}Client calls the endpoints of {{.StructName}} over HTTP,
+// params are sent in the form like they are named in the apivalidator tags
+type {{.StructName}}Client struct {
+	// BaseURL is the url of the service, the urls of the endpoints are relative to it
+	BaseURL string
+	// HTTPClient sends the requests, http.DefaultClient is used if it is nil
+	HTTPClient *http.Client
+	// Credentials are sent to the endpoints requiring auth the way their strategy
+	// expects them: the token, the API key or user:password of basic auth
+	Credentials string
+	// Header is sent with every request, e.g. with the credentials of method auth
+	Header http.Header
+}
+
+func New{{.StructName}}Client(baseURL string) *{{.StructName}}Client {
+	return &{{.StructName}}Client{BaseURL: baseURL}
+}
+
+func (c *{{.StructName}}Client) do(r *http.Request, res interface{}) error {
+	for key, values := range c.Header {
+		for _, value := range values {
+			r.Header.Add(key, value)
+		}
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return decodeResponse(resp, res)
+}
+`))
+
+	clientMethodTpl = template.Must(template.New("clientMethodTpl").Parse(`
+// {{.MethodName}} calls {{.StructName}}.{{.MethodName}}
+func (c *{{.StructName}}Client) {{.MethodName}}(ctx context.Context, in {{.Type}}{{.Path}}) ({{.Conv}}, error) {
+	params := url.Values{}`))
+
+	clientRequestTpl = template.Must(template.New("clientRequestTpl").Parse(`
+	r, err := newClientRequest(ctx, "{{.Kind}}", c.BaseURL+{{.Source}}, params)
+	if err != nil {
+		var zero {{.Conv}}
+		return zero, err
+	}
+`))
+
+	clientCallTpl = template.Must(template.New("clientCallTpl").Parse(`
+	var res {{.Conv}}
+	err = c.do(r, &res)
+
+	return res, err
+}
+`))
+
+	clientParamTpl = template.Must(template.New("clientParamTpl").Parse(`
+	{{- if .Ptr}}
+	if {{.Value}} != nil {
+		params.Set("{{.Param}}", {{.Source}})
+	}
+	{{- else if .Fields}}
+	for _, item := range {{.Value}} {
+		params.Add("{{.Param}}", {{.Source}})
+	}
+	{{- else}}
+	params.Set("{{.Param}}", {{.Source}})
+	{{- end}}`))
+
+	clientAuthTpl = template.Must(template.New("clientAuthTpl").Parse(`
+	{{- if eq .Kind "token" "apikey"}}
+	{{- if .Param}}
+	query := r.URL.Query()
+	query.Set("{{.Param}}", c.Credentials)
+	r.URL.RawQuery = query.Encode()
+	{{- else}}
+	r.Header.Set("{{.Type}}", c.Credentials)
+	{{- end}}
+	{{- else if eq .Kind "bearer"}}
+	r.Header.Set("Authorization", "Bearer "+c.Credentials)
+	{{- else if eq .Kind "basic"}}
+	user, password, _ := strings.Cut(c.Credentials, ":")
+	r.SetBasicAuth(user, password)
+	{{- end}}
+`))
+
+	newClientRequestTpl = template.Must(template.New("newClientRequestTpl").Parse(`
+// newClientRequest builds the request sending the params
+// in the form body if the method has a body or in the query otherwise
+func newClientRequest(ctx context.Context, method, rawURL string, params url.Values) (*http.Request, error) {
+	var body io.Reader
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		body = strings.NewReader(params.Encode())
+	default:
+		if len(params) != 0 {
+			rawURL += "?" + params.Encode()
+		}
+	}
+
+	r, err := http.NewRequestWithContext(ctx, method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	return r, nil
+}
+`))
+
+	decodeResponseTpl = template.Must(template.New("decodeResponseTpl").Parse(`
+{{- if eq .Kind "problem"}}
+// decodeResponse decodes the result, errors are decoded from problem details
+// and returned with the status of the response
+func decodeResponse(resp *http.Response, res interface{}) error {
+	if resp.StatusCode >= http.StatusBadRequest {
+		var problem struct {
+			Title  string ` + "`" + `json:"title"` + "`" + `
+			Detail string ` + "`" + `json:"detail"` + "`" + `
+		}
+		json.NewDecoder(resp.Body).Decode(&problem)
+
+		message := problem.Detail
+		if message == "" {
+			message = problem.Title
+		}
+		if message == "" {
+			message = http.StatusText(resp.StatusCode)
+		}
+		return {{.Source}}
+	}
+
+	return json.NewDecoder(resp.Body).Decode(res)
+}
+{{- else}}
+// decodeResponse decodes the result from the {"error": ..., "response": ...} envelope,
+// errors are returned with the status of the response
+func decodeResponse(resp *http.Response, res interface{}) error {
+	var envelope struct {
+		Error    string          ` + "`" + `json:"error"` + "`" + `
+		Response json.RawMessage ` + "`" + `json:"response"` + "`" + `
+	}
+	err := json.NewDecoder(resp.Body).Decode(&envelope)
+
+	if resp.StatusCode >= http.StatusBadRequest || envelope.Error != "" {
+		message := envelope.Error
+		if message == "" {
+			message = http.StatusText(resp.StatusCode)
+		}
+		return {{.Source}}
+	}
+	if err != nil {
+		return fmt.Errorf("bad response: %w", err)
+	}
+
+	return json.Unmarshal(envelope.Response, res)
+}
+{{- end}}
+`))
+
+	clientErrorTpl = template.Must(template.New("clientErrorTpl").Parse(`
+// ClientError is the error replied by the service with the status of the response
+type ClientError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e ClientError) Error() string {
+	return e.Message
+}
+
+func (e ClientError) HTTPStatus() int {
+	return e.StatusCode
+}
+`))
+)
+
+// serviceClient writes the client of the service with a method per endpoint
+func (g *generator) serviceClient(srv *service) {
+	g.use("net/http")
+	clientTpl.Execute(&g.out, tpl{
+		StructName: srv.Name,
+	})
+
+	for _, ep := range srv.Endpoints {
+		g.clientMethod(srv, ep)
+	}
+}
+
+// clientMethod writes the method calling the endpoint, placeholders
+// of the url not filled from the params are passed after the params
+func (g *generator) clientMethod(srv *service, ep *endpoint) {
+	out := &g.out
+	g.use("context")
+	g.use("net/url")
+
+	result := g.typeString(ep.Result)
+	path := fmt.Sprintf("%q", ep.Spec.URL)
+	var args []string
+	if ep.Route != nil {
+		path, args = g.clientPath(ep)
+	}
+	var extra string
+	for _, arg := range args {
+		extra += ", " + arg + " string"
+	}
+
+	clientMethodTpl.Execute(out, tpl{
+		StructName: srv.Name,
+		MethodName: ep.Name,
+		Type:       g.typeString(ep.Params.Type),
+		Path:       extra,
+		Conv:       result,
+	})
+
+	for _, f := range ep.Params.Fields {
+		g.clientParam(f, "in."+f.Name)
+	}
+	fmt.Fprintln(out)
+
+	method := http.MethodPost
+	if len(ep.Spec.Methods) != 0 {
+		method = ep.Spec.Methods[0]
+	}
+	clientRequestTpl.Execute(out, tpl{
+		Kind:   method,
+		Source: path,
+		Conv:   result,
+	})
+
+	if auth := ep.Spec.Auth; auth != nil {
+		if auth.Type == "basic" {
+			g.use("strings")
+		}
+		clientAuthTpl.Execute(out, tpl{
+			Kind:  auth.Type,
+			Param: auth.Query,
+			Type:  auth.Header,
+		})
+	}
+
+	clientCallTpl.Execute(out, tpl{
+		Conv: result,
+	})
+}
+
+// clientPath returns the expression of the url of the endpoint with
+// the placeholders filled and the args of the placeholders without fields
+func (g *generator) clientPath(ep *endpoint) (string, []string) {
+	g.use("net/url")
+
+	var parts, args []string
+	for _, part := range pathParts(ep) {
+		if part.Text != "" {
+			parts = append(parts, fmt.Sprintf("%q", part.Text))
+		}
+		if part.Param == "" {
+			continue
+		}
+
+		var value string
+		if part.Field != nil {
+			value = g.formatValue(part.Field, "in."+part.Field.Name)
+		} else {
+			value = clientArgName(part.Param)
+			args = append(args, value)
+		}
+		parts = append(parts, "url.PathEscape("+value+")")
+	}
+
+	return strings.Join(parts, " + "), args
+}
+
+// clientArgName turns the name of a placeholder into a Go identifier
+func clientArgName(name string) string {
+	name = strings.ReplaceAll(name, ".", "_")
+	if token.IsKeyword(name) || name == "in" || name == "ctx" || name == "c" {
+		name += "_"
+	}
+
+	return name
+}
+
+// clientParam writes the code setting the form params of the field
+func (g *generator) clientParam(f *field, value string) {
+	out := &g.out
+
+	switch {
+	case f.Rules.Source == "path":
+	case f.Fields != nil:
+		if f.Ptr {
+			fmt.Fprint(out, "\n	if "+value+" != nil {")
+		}
+		for _, child := range f.Fields {
+			g.clientParam(child, "in."+child.Name)
+		}
+		if f.Ptr {
+			fmt.Fprint(out, "\n	}")
+		}
+	case f.Slice:
+		clientParamTpl.Execute(out, tpl{
+			Fields: true,
+			Value:  value,
+			Param:  f.Param,
+			Source: g.formatValue(f, "item"),
+		})
+	case f.Ptr:
+		clientParamTpl.Execute(out, tpl{
+			Ptr:    true,
+			Value:  value,
+			Param:  f.Param,
+			Source: g.formatValue(f, "*"+value),
+		})
+	default:
+		clientParamTpl.Execute(out, tpl{
+			Value:  value,
+			Param:  f.Param,
+			Source: g.formatValue(f, value),
+		})
+	}
+}
+
+// formatValue returns the expression formatting the value of the field
+// as the form param, for slices it is the value of an item
+func (g *generator) formatValue(f *field, value string) string {
+	t := f.Type
+	if f.Slice {
+		t = f.Elem
+	}
+
+	if isDuration(t) {
+		if strings.HasPrefix(value, "*") {
+			value = "(" + value + ")"
+		}
+		return value + ".String()"
+	}
+
+	kind := kinds[f.Kind]
+	// numbers are converted anyway, strings and bools only if their type is named
+	if (kind.Parser == "" || kind.Parser == "ParseBool") && g.typeString(t) != f.Kind {
+		value = f.Kind + "(" + value + ")"
+	}
+	if kind.Parser != "" {
+		g.use("strconv")
+	}
+	switch kind.Parser {
+	case "":
+		return value
+	case "ParseBool":
+		return "strconv.FormatBool(" + value + ")"
+	case "ParseInt":
+		return "strconv.FormatInt(int64(" + value + "), 10)"
+	case "ParseUint":
+		return "strconv.FormatUint(uint64(" + value + "), 10)"
+	}
+
+	return fmt.Sprintf("strconv.FormatFloat(float64(%s), 'g', -1, %d)", value, kind.Bits)
+}
+
+// clientHelpers writes the helpers shared by the clients,
+// errors are returned as ApiError if the package has one with field Err
+func (g *generator) clientHelpers() {
+	g.use("context")
+	g.use("encoding/json")
+	g.use("io")
+	g.use("net/http")
+	g.use("net/url")
+	g.use("strings")
+	newClientRequestTpl.Execute(&g.out, tpl{})
+
+	newError := "ClientError{StatusCode: resp.StatusCode, Message: message}"
+	if named := apiErrorType(g.pkg); named != nil {
+		obj, _, _ := types.LookupFieldOrMethod(named, false, g.pkg, "Err")
+		if errField, ok := obj.(*types.Var); ok && types.Identical(errField.Type(), types.Universe.Lookup("error").Type()) {
+			g.use("errors")
+			newError = g.typeString(named) + "{HTTPStatus: resp.StatusCode, Err: errors.New(message)}"
+		}
+	}
+	if strings.HasPrefix(newError, "ClientError") {
+		clientErrorTpl.Execute(&g.out, tpl{})
+	}
+
+	if g.opts.Envelope != "problem" {
+		g.use("fmt")
+	}
+	decodeResponseTpl.Execute(&g.out, tpl{
+		Kind:   g.opts.Envelope,
+		Source: newError,
+	})
+}
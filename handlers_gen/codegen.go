@@ -1,527 +1,2059 @@
 package main
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
-	"go/ast"
-	"go/parser"
+	"go/format"
 	"go/token"
+	"go/types"
 	"log"
+	"net/http"
 	"os"
-	"reflect"
-	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
 )
 
 type tpl struct {
-	FieldName string
-	StructName string
-	SwitchName string
+	FieldName   string
+	StructName  string
+	Challenge   string
+	SwitchName  string
 	WrapperName string
-	Path string
-	MethodName string
-	Param string
-	ParamName string
-	Min string
-	Max string
-	Enum string
-	Enums string
-	Dflt string
+	Path        string
+	MethodName  string
+	Param       string
+	Min         string
+	Max         string
+	Enum        string
+	Enums       string
+	Dflt        string
+	Type        string
+	Conv        string
+	Kind        string
+	Parser      string
+	ParseArgs   string
+	Zero        string
+	Value       string
+	Source      string
+	CSV         bool
+	Fields      bool
+	Ptr         bool
+	Rule        string
+	Message     string
+	MaxBody     int64
+	Allow       string
+	Methods     string
+	Index       int
+	// Fail returns the statement failing the validation, see generator.fail
+	Fail func(field, rule, message string) string
 }
 
 var (
+	wrapperParamsTpl = template.Must(template.New("wrapperParamsTpl").Parse(`
+	output := {{.Type}}{}
+	{{if .Fields}}fromJSON, err := bindJSON(w, r, &output)
+	if err != nil {{else}}if _, err := bindJSON(w, r, &output); err != nil {{end}}{
+		err := err.(bindError)
+		writeError(w, err.status, err.Error())
+		return
+	}
+`))
+
+	routerTpl = template.Must(template.New("routerTpl").Parse(`
+// {{.StructName}}Router routes requests to the endpoints of {{.StructName}}.
+// Requests go through the middleware added with Use in the order they are added,
+// then through the middleware of the endpoint in the order they are listed in its annotation
+type {{.StructName}}Router struct {
+	middlewares []func(http.Handler) http.Handler
+	handler     http.Handler
+
+	// handlers of the endpoints
+`))
+
+	newRouterTpl = template.Must(template.New("newRouterTpl").Parse(`}
+
+// New{{.StructName}}Router builds the handlers of the endpoints wrapped into their middleware
+func New{{.StructName}}Router(srv *{{.StructName}}) *{{.StructName}}Router {
+	rt := &{{.StructName}}Router{}
+	rt.handler = http.HandlerFunc(rt.route)
+`))
+
+	useTpl = template.Must(template.New("useTpl").Parse(`
+	return rt
+}
+
+// Use adds middleware wrapping every request to the service
+func (rt *{{.StructName}}Router) Use(middlewares ...func(http.Handler) http.Handler) {
+	rt.middlewares = append(rt.middlewares, middlewares...)
+
+	rt.handler = http.HandlerFunc(rt.route)
+	for i := len(rt.middlewares) - 1; i >= 0; i-- {
+		rt.handler = rt.middlewares[i](rt.handler)
+	}
+}
+
+func (rt *{{.StructName}}Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.handler.ServeHTTP(w, r)
+}
+
+// {{.FieldName}} are the routers ServeHTTP of {{.StructName}} builds once per service
+var {{.FieldName}} sync.Map
+
+// ServeHTTP routes requests with the router built on the first request,
+// serve New{{.StructName}}Router(srv) to add middleware with Use
+func (srv *{{.StructName}}) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt, built := {{.FieldName}}.Load(srv)
+	if !built {
+		rt, _ = {{.FieldName}}.LoadOrStore(srv, New{{.StructName}}Router(srv))
+	}
+	rt.(*{{.StructName}}Router).ServeHTTP(w, r)
+}
+`))
+
 	srvHTTPTpl = template.Must(template.New("srvTpl").Parse(`
 // {{.StructName}}
-func (srv *{{.StructName}}) ServeHTTP(w http.ResponseWriter, r *http.Request) {`))
+func (rt *{{.StructName}}Router) route(w http.ResponseWriter, r *http.Request) {`))
 
 	switchTpl = template.Must(template.New("switchTpl").Parse(`
 	// {{.SwitchName}}
 	switch r.URL.Path {`))
 
 	caseTpl = template.Must(template.New("caseTpl").Parse(`
-	case "{{.Path}}":
-		srv.{{.MethodName}}Wrapper(w, r)`))
+	case "{{.Path}}":`))
+
+	handlerCallTpl = template.Must(template.New("handlerCallTpl").Parse(`
+		rt.{{.FieldName}}.ServeHTTP(w, r)`))
+
+	methodSwitchTpl = template.Must(template.New("methodSwitchTpl").Parse(`
+		switch r.Method {`))
+
+	methodCaseTpl = template.Must(template.New("methodCaseTpl").Parse(`
+		case {{.Methods}}:
+			rt.{{.FieldName}}.ServeHTTP(w, r)`))
+
+	methodDefaultTpl = template.Must(template.New("methodDefaultTpl").Parse(`
+		default:
+			replyAllow(w, r, "{{.Allow}}")
+		}`))
+
+	routeVarTpl = template.Must(template.New("routeVarTpl").Parse(`
+	{{.FieldName}} = regexp.MustCompile({{printf "%q" .Path}})`))
+
+	routeMatchTpl = template.Must(template.New("routeMatchTpl").Parse(`
+		if match := {{.FieldName}}.FindStringSubmatch(r.URL.EscapedPath()); match != nil {`))
+
+	routeParamTpl = template.Must(template.New("routeParamTpl").Parse(`
+			r.SetPathValue("{{.Param}}", pathUnescape(match[{{.Index}}]))`))
+
+	pathUnescapeTpl = template.Must(template.New("pathUnescapeTpl").Parse(`
+// pathUnescape decodes a placeholder value matched in the escaped path,
+// so values may have slashes sent as %2F. The escaped path is made
+// by net/url, so it can only fail on values the router never gets
+func pathUnescape(value string) string {
+	unescaped, err := url.PathUnescape(value)
+	if err != nil {
+		return value
+	}
+
+	return unescaped
+}
+`))
+
+	routeReturnTpl = template.Must(template.New("routeReturnTpl").Parse(`
+			return
+		}`))
 
 	wrapperTpl = template.Must(template.New("wrapperTpl").Parse(`
 func (srv *{{.StructName}}) {{.WrapperName}}(w http.ResponseWriter, r *http.Request) {
+	defer recoverPanic(w, r, "{{.StructName}}.{{.MethodName}}")
+
+`))
+
+	recoverPanicTpl = template.Must(template.New("recoverPanicTpl").Parse(`
+// recoverPanic replies 500 to the request if its handler panicked,
+// the panic is logged along with the endpoint and the stack
+func recoverPanic(w http.ResponseWriter, r *http.Request, endpoint string) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	if p == http.ErrAbortHandler {
+		panic(p)
+	}
+	{{if .Param}}
+	requestID := r.Header.Get("{{.Param}}")
+	if requestID == "" {
+		requestID = newRequestID()
+	}
+	log.Printf("panic in %s %s, request id %s: %v\n%s", endpoint, r.URL.Path, requestID, p, debug.Stack())
+
+	w.Header().Set("{{.Param}}", requestID)
+	writeError(w, http.StatusInternalServerError, "internal error, request id "+requestID)
+	{{- else}}
+	log.Printf("panic in %s %s: %v\n%s", endpoint, r.URL.Path, p, debug.Stack())
+
+	writeError(w, http.StatusInternalServerError, fmt.Sprint(p))
+	{{- end}}
+}
+{{- if .Param}}
+
+// newRequestID returns a random id for requests which came without one
+func newRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+{{- end}}
 `))
 	paramStringTpl = template.Must(template.New("paramStringTpl").Parse(`
-	output.{{.ParamName}} = r.FormValue("{{.Param}}")`))
+	{{.Value}} = {{with .Conv}}{{.}}({{end}}{{.Source}}{{if .Conv}}){{end}}`))
 
-	paramIntTpl = template.Must(template.New("paramIntTpl").Parse(`
-	var err error	
-	output.{{.ParamName}}, err = strconv.Atoi(r.FormValue("{{.Param}}"))
+	paramNumberTpl = template.Must(template.New("paramNumberTpl").Parse(`
+	{{.FieldName}}Raw, err := strconv.{{.Parser}}({{.Source}}{{.ParseArgs}})
+	{{- if ne .Parser "ParseBool"}}
+	if errors.Is(err, strconv.ErrRange) {
+		{{call .Fail .Param "range" (print .Param " is out of " .Kind " range")}}
+	}
+	{{- end}}
 	if err != nil {
-		response, _ := json.Marshal(&Response{
-			"error": "{{.Param}} must be int",
-		})
+		{{call .Fail .Param "type" (print .Param " must be " .Kind)}}
+	}
+	{{.Value}} = {{.Type}}({{.FieldName}}Raw)`))
 
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write(response)
-		
-		return
-	}`))
+	paramDurationTpl = template.Must(template.New("paramDurationTpl").Parse(`
+	{{.FieldName}}Raw, err := time.ParseDuration({{.Source}})
+	if err != nil {
+		{{call .Fail .Param "type" (print .Param " must be a duration")}}
+	}
+	{{.Value}} = {{.FieldName}}Raw`))
 
 	checkRequestMethod = template.Must(template.New("checkRequestMethod").Parse(`
-func checkRequestMethod(availableMethod string, r *http.Request) error {
-	if availableMethod == r.Method || availableMethod == "" {
+// checkRequestMethod allows any method if availableMethods are empty
+func checkRequestMethod(r *http.Request, availableMethods ...string) error {
+	if len(availableMethods) == 0 {
 		return nil
 	}
-	
+	for _, availableMethod := range availableMethods {
+		if availableMethod == r.Method {
+			return nil
+		}
+	}
+
 	return fmt.Errorf("%s", "bad method")
 }
 `))
 
-	checkAuth = template.Must(template.New("checkAuth").Parse(`
-func checkAuth(r *http.Request) error {
-	auth := r.Header.Get("X-Auth")
-	if auth == "100500" {
-		return nil
+	replyAllowTpl = template.Must(template.New("replyAllowTpl").Parse(`
+// replyAllow replies to requests of a url served by several endpoints
+// if none of them accepts the method, OPTIONS is replied with the methods allowed
+func replyAllow(w http.ResponseWriter, r *http.Request, allow string) {
+	w.Header().Set("Allow", allow)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
 	}
-	
-	return fmt.Errorf("%s", "unauthorized")
+	writeError(w, http.StatusMethodNotAllowed, "bad method")
 }
 `))
 
-	checkForRequestParamTpl = template.Must(template.New("checkForRequestParamTpl").Parse(`
-	if output.{{.ParamName}} == "" {
-		response, _ := json.Marshal(&Response{
-			"error": "{{.Param}} must me not empty",
-		})
+	methodTpl = template.Must(template.New("methodTpl").Parse(`	if r.Method == http.MethodOptions {
+		w.Header().Set("Allow", "{{.Allow}}")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	{{- if .Methods}}
+	if err := checkRequestMethod(r, {{.Methods}}); err != nil {
+		w.Header().Set("Allow", "{{.Allow}}")
+		writeError(w, http.StatusMethodNotAllowed, err.Error())
+		return
+	}
+	{{- end}}
+`))
 
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write(response)
+	authTpl = template.Must(template.New("authTpl").Parse(`
+	principal, err := {{.Source}}
+	if err != nil {
+		{{- with .Challenge}}
+		w.Header().Set("WWW-Authenticate", {{printf "%q" .}})
+		{{- end}}
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	r = r.WithContext(context.WithValue(r.Context(), principalKey{}, principal))
+`))
 
+	authorizeTpl = template.Must(template.New("authorizeTpl").Parse(`
+	if err := {{.Source}}; err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
 		return
 	}
 `))
 
-	checkForMinimumLenTpl = template.Must(template.New("checkForMinimumLenTpl").Parse(`
-	if len(output.{{.ParamName}}) < {{.Min}} {
-		response, _ := json.Marshal(&Response{
-			"error": "{{.Param}} len must be >= {{.Min}}",
-		})
+	checkRolesTpl = template.Must(template.New("checkRolesTpl").Parse(`
+var errForbidden = errors.New("forbidden")
 
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write(response)
+// checkRoles allows principals having any of the roles
+func checkRoles(principalRoles []string, roles ...string) error {
+	for _, role := range principalRoles {
+		for _, allowed := range roles {
+			if role == allowed {
+				return nil
+			}
+		}
+	}
 
-		return
+	return errForbidden
+}
+`))
+
+	checkScopesTpl = template.Must(template.New("checkScopesTpl").Parse(`
+// checkScopes allows principals having all of the scopes
+func checkScopes(principalScopes []string, scopes ...string) error {
+	for _, scope := range scopes {
+		granted := false
+		for _, principalScope := range principalScopes {
+			granted = granted || principalScope == scope
+		}
+		if !granted {
+			return fmt.Errorf("scope %s is required", scope)
+		}
 	}
+
+	return nil
+}
 `))
 
-	checkForMinimumNumberTpl = template.Must(template.New("checkForMinimumNumberTpl").Parse(`
-	if output.{{.ParamName}} < {{.Min}} {
-		response, _ := json.Marshal(&Response{
-			"error": "{{.Param}} must be >= {{.Min}}",
-		})
+	principalTpl = template.Must(template.New("principalTpl").Parse(`
+// principalKey is the context key of the principal a request is authenticated as
+type principalKey struct{}
 
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write(response)
-		
-		return
+// PrincipalFromContext returns the principal the request was authenticated as,
+// it is the result of Authenticate of the service for method auth
+// and StaticPrincipal for the other strategies
+func PrincipalFromContext(ctx context.Context) (interface{}, bool) {
+	principal := ctx.Value(principalKey{})
+
+	return principal, principal != nil
+}
+`))
+
+	staticAuthTpl = template.Must(template.New("staticAuthTpl").Parse(`
+// StaticPrincipal is the principal of requests authenticated by a credential
+// set in the environment, Name is the user of HTTP Basic auth
+type StaticPrincipal struct {
+	Scheme string
+	Name   string
+}
+
+var errUnauthorized = errors.New("unauthorized")
+
+// checkSecret compares the credential with the value of the env variable
+// in constant time, nothing matches an unset variable
+func checkSecret(credential, env string) error {
+	secret := os.Getenv(env)
+	if secret == "" || subtle.ConstantTimeCompare([]byte(credential), []byte(secret)) != 1 {
+		return errUnauthorized
 	}
+
+	return nil
+}
 `))
 
-	checkForMaximumLenTpl = template.Must(template.New("checkForMaximumLenTpl").Parse(`
-	if len(output.{{.ParamName}}) > {{.Max}} {
-		response, _ := json.Marshal(&Response{
-			"error": "{{.Param}} len must be <= {{.Min}}",
-		})
+	authTokenTpl = template.Must(template.New("authTokenTpl").Parse(`
+// authToken authenticates requests by the token sent in the header
+func authToken(r *http.Request, header, env string) (interface{}, error) {
+	if err := checkSecret(r.Header.Get(header), env); err != nil {
+		return nil, err
+	}
 
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write(response)
-		
-		return
+	return StaticPrincipal{Scheme: "token"}, nil
+}
+`))
+
+	authBearerTpl = template.Must(template.New("authBearerTpl").Parse(`
+// authBearer authenticates requests by the bearer token of the Authorization header
+func authBearer(r *http.Request, env string) (interface{}, error) {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		return nil, errUnauthorized
+	}
+	if err := checkSecret(token, env); err != nil {
+		return nil, err
+	}
+
+	return StaticPrincipal{Scheme: "bearer"}, nil
+}
+`))
+
+	authBasicTpl = template.Must(template.New("authBasicTpl").Parse(`
+// authBasic authenticates requests by HTTP Basic credentials,
+// the env variable is set to user:password
+func authBasic(r *http.Request, env string) (interface{}, error) {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, errUnauthorized
+	}
+	if err := checkSecret(user+":"+password, env); err != nil {
+		return nil, err
+	}
+
+	return StaticPrincipal{Scheme: "basic", Name: user}, nil
+}
+`))
+
+	authAPIKeyTpl = template.Must(template.New("authAPIKeyTpl").Parse(`
+// authAPIKey authenticates requests by the key sent in the header or in the query
+func authAPIKey(r *http.Request, header, query, env string) (interface{}, error) {
+	key := r.Header.Get(header)
+	if query != "" {
+		key = r.URL.Query().Get(query)
+	}
+	if err := checkSecret(key, env); err != nil {
+		return nil, err
+	}
+
+	return StaticPrincipal{Scheme: "apikey"}, nil
+}
+`))
+
+	checkForRequestParamTpl = template.Must(template.New("checkForRequestParamTpl").Parse(`
+	if {{with .Zero}}{{$.Value}} == {{.}}{{else}}len({{.Value}}) == 0{{end}} {
+		{{call .Fail .Param "required" (print .Param " must me not empty")}}
+	}
+`))
+
+	checkForMinimumLenTpl = template.Must(template.New("checkForMinimumLenTpl").Parse(`
+	if len({{.Value}}) < {{.Min}} {
+		{{call .Fail .Param "min" (print .Param " len must be >= " .Min)}}
+	}
+`))
+
+	checkForMinimumNumberTpl = template.Must(template.New("checkForMinimumNumberTpl").Parse(`
+	if {{.Value}} < {{.Min}} {
+		{{call .Fail .Param "min" (print .Param " must be >= " .Min)}}
+	}
+`))
+
+	checkForMaximumLenTpl = template.Must(template.New("checkForMaximumLenTpl").Parse(`
+	if len({{.Value}}) > {{.Max}} {
+		{{call .Fail .Param "max" (print .Param " len must be <= " .Max)}}
 	}
 `))
 
 	checkForMaximumNumberTpl = template.Must(template.New("checkForMaximumNumberTpl").Parse(`
-	if output.{{.ParamName}} > {{.Max}} {
-		response, _ := json.Marshal(&Response{
-			"error": "{{.Param}} must be <= {{.Max}}",
-		})
+	if {{.Value}} > {{.Max}} {
+		{{call .Fail .Param "max" (print .Param " must be <= " .Max)}}
+	}
+`))
 
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write(response)
+	validatorTpl = template.Must(template.New("validatorTpl").Parse(`
+	{{if .Ptr}}if {{.Value}} != nil {
+	{{end}}if err := {{.Source}}(r.Context(), {{if .Ptr}}*{{end}}{{.Value}}); err != nil {
+		{{call .Fail .Param "validate" "err.Error()"}}
+	}
+	{{- if .Ptr}}
+	}{{end}}
+`))
+
+	crossFieldTpl = template.Must(template.New("crossFieldTpl").Parse(`
+	if {{.Source}} {
+		{{call .Fail .Param .Rule .Message}}
+	}
+`))
 
+	validateTpl = template.Must(template.New("validateTpl").Parse(`
+	if err := output.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 `))
 
+	checkForPatternTpl = template.Must(template.New("checkForPatternTpl").Parse(`
+	if {{.Value}} != "" && !{{.FieldName}}.MatchString({{.Source}}) {
+		{{call .Fail .Param "pattern" (print .Param " must match " .Path)}}
+	}
+`))
+
+	checkForFormatTpl = template.Must(template.New("checkForFormatTpl").Parse(`
+	if {{.Value}} != "" && !{{.FieldName}}({{.Source}}) {
+		{{call .Fail .Param "format" (print .Param " must be a valid " .Kind)}}
+	}
+`))
+
+	patternsTpl = template.Must(template.New("patternsTpl").Parse(`
+// patterns of pattern rules compiled once
+var (
+	{{- range $i, $pattern := .}}
+	pattern{{$i}} = regexp.MustCompile({{printf "%q" $pattern}})
+	{{- end}}
+)
+`))
+
+	formatEmailTpl = template.Must(template.New("formatEmailTpl").Parse(`
+// isEmail reports whether the value is a bare address like user@example.com
+func isEmail(value string) bool {
+	address, err := mail.ParseAddress(value)
+
+	return err == nil && address.Address == value
+}
+`))
+
+	formatUUIDTpl = template.Must(template.New("formatUUIDTpl").Parse(`
+var uuidPattern = regexp.MustCompile("^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$")
+
+// isUUID reports whether the value is a UUID in the canonical form
+func isUUID(value string) bool {
+	return uuidPattern.MatchString(value)
+}
+`))
+
+	formatURLTpl = template.Must(template.New("formatURLTpl").Parse(`
+// isURL reports whether the value is an absolute url
+func isURL(value string) bool {
+	u, err := url.Parse(value)
+
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+`))
+
+	formatIPv4Tpl = template.Must(template.New("formatIPv4Tpl").Parse(`
+// isIPv4 reports whether the value is an IPv4 address in dotted decimal form
+func isIPv4(value string) bool {
+	addr, err := netip.ParseAddr(value)
+
+	return err == nil && addr.Is4()
+}
+`))
+
+	formatDateTimeTpl = template.Must(template.New("formatDateTimeTpl").Parse(`
+// isDateTime reports whether the value is an RFC 3339 date-time
+func isDateTime(value string) bool {
+	_, err := time.Parse(time.RFC3339, value)
+
+	return err == nil
+}
+`))
+
 	enumSwitchTpl = template.Must(template.New("enumSwitchTpl").Parse(`
-	if output.{{.ParamName}} != "" {
-		switch output.{{.ParamName}} {`))
+	if {{.Value}} != {{.Zero}} {
+		switch {{.Value}} {`))
 
 	enumCaseTpl = template.Must(template.New("enumCaseTpl").Parse(`
-		case "{{.Enum}}":
+		case {{.Enum}}:
 			break`))
 
 	enumDefaultTpl = template.Must(template.New("enumDefaultTpl").Parse(`
 		default:
-			response, _ := json.Marshal(&Response{
-			"error": "{{.Param}} must be one of {{.Enums}}",
-			})
+			{{call .Fail .Param "enum" (print .Param " must be one of " .Enums)}}
+		}
+	}
+`))
 
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write(response)
+	sliceParamTpl = template.Must(template.New("sliceParamTpl").Parse(`
+	for _, value := range formValues(r, "{{.Param}}", {{.CSV}}) {
+		var item {{.Type}}`))
 
-			return
-		}
-	} else {
-		output.{{.ParamName}} = "{{.Dflt}}"
+	sliceAppendTpl = template.Must(template.New("sliceAppendTpl").Parse(`
+		{{.Value}} = append({{.Value}}, item)
 	}
 `))
 
-	resultTpl = template.Must(template.New("resultTpl").Parse(`
-	res, err := srv.{{.MethodName}}(r.Context(), output)
-	if err != nil {
-		switch err.(type) {
-		case ApiError:
-			err := err.(ApiError)
-			response, _ := json.Marshal(&Response{
-			"error": err.Error(),
-			})
+	numberParamTpl = template.Must(template.New("numberParamTpl").Parse(`
+		if value := r.FormValue("{{.Param}}"); value != "" {`))
 
-			w.WriteHeader(err.HTTPStatus)
-			w.Write(response)
-		case error:
-			response, _ := json.Marshal(&Response{
-			"error": err.Error(),
-			})
+	ptrParamTpl = template.Must(template.New("ptrParamTpl").Parse(`
+		if value, exists := formValue(r, "{{.Param}}"); exists {
+			var item {{.Type}}`))
 
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write(response)
-		}
-		
-		return
+	ptrAssignTpl = template.Must(template.New("ptrAssignTpl").Parse(`
+			{{.Value}} = &item
+		}`))
+
+	defaultTpl = template.Must(template.New("defaultTpl").Parse(`
+	if {{.Source}} {
+		{{.Value}} = {{.Dflt}}
 	}
+`))
 
-	response, _ := json.Marshal(&Response{
-		"error": "",
-		"response": res, 
-	})
+	formDefaultTpl = template.Must(template.New("formDefaultTpl").Parse(`
+		} else {
+			{{.Value}} = {{.Dflt}}
+		}`))
 
-	w.Write(response)
+	ptrDefaultTpl = template.Must(template.New("ptrDefaultTpl").Parse(`
+	if {{.Value}} == nil {
+		{{.FieldName}}Default := {{.Type}}({{.Dflt}})
+		{{.Value}} = &{{.FieldName}}Default
+	}
 `))
-)
 
-func getMethodsAndStructs(node *ast.File, findMethods map[string][]*ast.FuncDecl, findStructs map[string][]*ast.Field) {
-	for _, f := range node.Decls {
-		d, ok := f.(*ast.FuncDecl)
-		if ok {
-			if !strings.HasPrefix(d.Doc.Text(), "apigen:api"){
-				continue
-			}
+	ptrStructTpl = template.Must(template.New("ptrStructTpl").Parse(`
+	if !fromJSON && formHasPrefix(r, "{{.Param}}.") {
+		{{.Value}} = &{{.Type}}{}
+	}
+`))
 
-			findStruct := d.Recv.List
-			for _, spec := range findStruct {
-				findStructType := spec.Type
-				switch fst := findStructType.(type) {
-				case *ast.StarExpr:
-					findStructName := fmt.Sprintf("%s", fst.X)
-					findMethods[findStructName] = append(findMethods[findStructName], d)
-				}
-			}
-		} else {
-			g, ok := f.(*ast.GenDecl)
-			if !ok {
-				log.Println("Type %T is not *ast.GenDecl", g)
-				continue
-			}
+	checkForMinimumItemsTpl = template.Must(template.New("checkForMinimumItemsTpl").Parse(`
+	if len({{.Value}}) < {{.Min}} {
+		{{call .Fail .Param "minItems" (print .Param " must contain >= " .Min " items")}}
+	}
+`))
 
-			for _, spec := range g.Specs {
-				currType, ok := spec.(*ast.TypeSpec)
-				if !ok {
-					log.Printf("SKIP %T is not *ast.TypeSpec\n", currType)
-					continue
-				}
-
-				currStruct, ok := currType.Type.(*ast.StructType)
-				if !ok {
-					log.Print("SKIP %T is not *ast.StructType\n", currStruct)
-					continue
-				}
-
-				structName := currType.Name.Name
-
-			FIELDSLOOP:
-				for _, field := range currStruct.Fields.List {
-					if field.Tag != nil {
-						tag := reflect.StructTag(field.Tag.Value[1:len(field.Tag.Value)-1])
-						if tag.Get("cgen") == "-" {
-							continue FIELDSLOOP
-						}
-						if _, exists := tag.Lookup("apivalidator"); exists {
-							findStructs[structName] = append(findStructs[structName], field)
-							continue FIELDSLOOP
-						}
-						if _, exists := tag.Lookup("json"); exists {
-							findStructs[structName] = append(findStructs[structName], field)
-						}
-					}
-				}
-			}
+	checkForMaximumItemsTpl = template.Must(template.New("checkForMaximumItemsTpl").Parse(`
+	if len({{.Value}}) > {{.Max}} {
+		{{call .Fail .Param "maxItems" (print .Param " must contain <= " .Max " items")}}
+	}
+`))
+
+	checkForUniqueItemsTpl = template.Must(template.New("checkForUniqueItemsTpl").Parse(`
+	{{.FieldName}}Seen := make(map[{{.Type}}]bool, len({{.Value}}))
+	for _, item := range {{.Value}} {
+		if {{.FieldName}}Seen[item] {
+			{{call .Fail .Param "unique" (print .Param " must contain unique items")}}
 		}
+		{{.FieldName}}Seen[item] = true
 	}
-}
+`))
 
-func getURLFromComments(methodName *ast.FuncDecl) string {
+	collectStartTpl = template.Must(template.New("collectStartTpl").Parse(`
+	if fieldErr := func() *FieldError {`))
 
-	var url string
+	collectEndTpl = template.Must(template.New("collectEndTpl").Parse(`
+		return nil
+	}(); fieldErr != nil {
+		fieldErrors = append(fieldErrors, *fieldErr)
+	}
+`))
 
-	for _, path := range methodName.Doc.List {
-		s := regexp.MustCompile(`"/[^"]*"`).FindString(path.Text)
-		url = regexp.MustCompile(`"`).Split(s, -1)[1]
+	collectReplyTpl = template.Must(template.New("collectReplyTpl").Parse(`
+	if len(fieldErrors) != 0 {
+		writeFieldErrors(w, fieldErrors)
+		return
 	}
+`))
 
-	return url
+	fieldErrorsTpl = template.Must(template.New("fieldErrorsTpl").Parse(`
+// FieldError is a validation error of a param, Rule is the failed rule
+// like min or required, or type and range if the param can't be parsed
+type FieldError struct {
+	Field   string ` + "`" + `json:"field"` + "`" + `
+	Rule    string ` + "`" + `json:"rule"` + "`" + `
+	Message string ` + "`" + `json:"message"` + "`" + `
 }
 
-func getRequestMethod(methodName *ast.FuncDecl) string {
-	comments := methodName.Doc.Text()
-	matched, _ := regexp.MatchString(`"method": "[A-Z]*"`, comments)
-	if !matched {
-		return ""
-	}
+// writeFieldErrors writes validation errors of all params
+{{- if eq .Kind "problem"}} as problem details
+// with the errors extension member
+func writeFieldErrors(w http.ResponseWriter, fieldErrors []FieldError) {
+	response, _ := json.Marshal(&struct {
+		Problem
+		Errors []FieldError ` + "`" + `json:"errors"` + "`" + `
+	}{
+		Problem: Problem{
+			Type:   "about:blank",
+			Title:  http.StatusText(http.StatusBadRequest),
+			Status: http.StatusBadRequest,
+			Detail: "validation failed",
+		},
+		Errors: fieldErrors,
+	})
 
-	s := regexp.MustCompile(`"method": "[A-Z]*"`).FindString(comments)
-	method := regexp.MustCompile(`"`).Split(s, -1)[3]
+	w.Header().Set("Content-Type", "application/problem+json")
+{{- else}} in the {"error": ..., "errors": [...]} envelope
+func writeFieldErrors(w http.ResponseWriter, fieldErrors []FieldError) {
+	response, _ := json.Marshal(&Response{
+		"error":  "validation failed",
+		"errors": fieldErrors,
+	})
 
-	return method
+	w.Header().Set("Content-Type", "application/json")
+{{- end}}
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write(response)
 }
+`))
 
-func isAuth(methodName *ast.FuncDecl) bool {
-	comments := methodName.Doc.Text()
-	s := regexp.MustCompile(`"auth": [a-z]*`).FindString(comments)
-	auth := regexp.MustCompile(`: `).Split(s, -1)[1]
-	switch auth {
-	case "true":
-		return true
-	case "false":
-		return false
-	default:
-		log.Fatalln("Error auth")
-		return false
+	formValueTpl = template.Must(template.New("formValueTpl").Parse(`
+// formValue returns the first value of the param and whether it was sent at all
+func formValue(r *http.Request, param string) (string, bool) {
+	values := formValues(r, param, false)
+	if len(values) == 0 {
+		return "", false
 	}
-}
 
-func main() {
+	return values[0], true
+}
+`))
 
-	fSet := token.NewFileSet()
-	node, err := parser.ParseFile(fSet, os.Args[1], nil, parser.ParseComments)
-	if err != nil {
-		log.Fatal(err)
+	formHasPrefixTpl = template.Must(template.New("formHasPrefixTpl").Parse(`
+// formHasPrefix reports whether any param starting with prefix was sent
+func formHasPrefix(r *http.Request, prefix string) bool {
+	if r.Form == nil {
+		r.ParseMultipartForm(32 << 20)
+	}
+	for param := range r.Form {
+		if strings.HasPrefix(param, prefix) {
+			return true
+		}
 	}
 
-	out, _ := os.Create(os.Args[2])
-
-	fmt.Fprintln(out, `package ` + node.Name.Name)
-	fmt.Fprintln(out)
-	fmt.Fprintln(out, `import "net/http"`)
-	fmt.Fprintln(out, `import "fmt"`)
-	fmt.Fprintln(out, `import "strconv"`)
-	fmt.Fprintln(out, `import "encoding/json"`)
-	fmt.Fprintln(out)
-	fmt.Fprintln(out, `type Response map[string]interface{}`)
-	fmt.Fprintln(out)
+	return false
+}
+`))
 
-	findMethods := make(map[string][]*ast.FuncDecl)
-	findStructs := make(map[string][]*ast.Field)
+	bindJSONTpl = template.Must(template.New("bindJSONTpl").Parse(`
+// maxBodyBytes limits the size of JSON request bodies
+var maxBodyBytes int64 = {{.MaxBody}}
 
-	getMethodsAndStructs(node, findMethods, findStructs)
+// bindError is an error of reading params from the request body
+type bindError struct {
+	status int
+	err    error
+}
 
-	for structName, methodAst := range findMethods {
-		srvHTTPTpl.Execute(out, tpl{
-			StructName: structName,
-		})
-		switchTpl.Execute(out, tpl{
-			SwitchName: structName+"Switch",
-		})
+func (e bindError) Error() string {
+	return e.err.Error()
+}
 
-		for _, methodName := range methodAst {
-		FINDSTRUCTNAME:
-			for _, spec := range methodName.Recv.List{
-				switch typeOfStruct := spec.Type.(type) {
-				case *ast.StarExpr:
-					nameOfStruct := fmt.Sprintf("%s", typeOfStruct.X)
-					if nameOfStruct != structName {
-						log.Println(nameOfStruct, "!=", structName)
-						continue FINDSTRUCTNAME
-					}
-
-					break FINDSTRUCTNAME
-				}
-			}
+// bindJSON decodes JSON request body into output, false is returned
+// if the params are sent as a form and have to be read from it
+func bindJSON(w http.ResponseWriter, r *http.Request, output interface{}) (bool, error) {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return false, nil
+	}
 
-			caseTpl.Execute(out, tpl{
-				Path: getURLFromComments(methodName),
-				MethodName: methodName.Name.Name,
-			})
-		}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false, bindError{http.StatusUnsupportedMediaType, fmt.Errorf("bad content type %s", contentType)}
+	}
 
-		fmt.Fprintln(out, "\n	default:")
-		fmt.Fprintln(out, `		response, _ := json.Marshal(&Response{`)
-		fmt.Fprintln(out,`			"error": "unknown method",`)
-		fmt.Fprintln(out, `		})`)
-		fmt.Fprintln(out,`		w.WriteHeader(http.StatusNotFound)`)
-		fmt.Fprintln(out, `		w.Write(response)`)
-		fmt.Fprintln(out, `		return`)
-		fmt.Fprintln(out, "	}\n}")
+	switch {
+	case mediaType == "application/x-www-form-urlencoded", mediaType == "multipart/form-data":
+		return false, nil
+	case mediaType == "application/json", strings.HasSuffix(mediaType, "+json"):
+	default:
+		return false, bindError{http.StatusUnsupportedMediaType, fmt.Errorf("unsupported media type %s", mediaType)}
+	}
 
-		for _, methodName := range methodAst {
-			wrapperTpl.Execute(out, tpl{
-				WrapperName: methodName.Name.Name+"Wrapper",
-				StructName: structName,
-			})
+	var maxBytesErr *http.MaxBytesError
+	err = json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(output)
+	switch {
+	case err == nil, errors.Is(err, io.EOF):
+		return true, nil
+	case errors.As(err, &maxBytesErr):
+		return true, bindError{http.StatusRequestEntityTooLarge, fmt.Errorf("body must be <= %d bytes", maxBodyBytes)}
+	default:
+		return true, bindError{http.StatusBadRequest, fmt.Errorf("bad json: %v", err)}
+	}
+}
+`))
 
-			requestMethod := getRequestMethod(methodName)
-			fmt.Fprintln(out, `	if err := checkRequestMethod("`+requestMethod+`", r); err != nil {`)
-			fmt.Fprintln(out,`		response, _ := json.Marshal(&Response{`)
-			fmt.Fprintln(out, `				"error": err.Error(),`)
-			fmt.Fprintln(out, `		})`)
-			fmt.Fprintln(out, `		w.WriteHeader(http.StatusNotAcceptable)`)
-			fmt.Fprintln(out, `		w.Write(response)`)
-			fmt.Fprintln(out, `		return`)
-			fmt.Fprintln(out, `	}`)
-
-			if isAuth(methodName){
-				fmt.Fprintln(out, `	if err := checkAuth(r); err != nil {`)
-				fmt.Fprintln(out, `		response, _ := json.Marshal(&Response{`)
-				fmt.Fprintln(out, `			"error": err.Error(),`)
-				fmt.Fprintln(out, `		})`)
-
-				fmt.Fprintln(out, `		w.WriteHeader(http.StatusForbidden)`)
-				fmt.Fprintln(out, `		w.Write(response)`)
-				fmt.Fprintln(out, `		return`)
-				fmt.Fprintln(out, `	}`)
+	formValuesTpl = template.Must(template.New("formValuesTpl").Parse(`
+func formValues(r *http.Request, param string, csv bool) []string {
+	if r.Form == nil {
+		r.ParseMultipartForm(32 << 20)
+	}
+	if !csv {
+		return r.Form[param]
+	}
 
+	var values []string
+	for _, value := range r.Form[param] {
+		values = append(values, strings.Split(value, ",")...)
+	}
+
+	return values
+}
+`))
+
+	resultTpl = template.Must(template.New("resultTpl").Parse(`
+	res, err := srv.{{.MethodName}}(r.Context(), output)
+	if err != nil {
+		writeError(w, errorStatus(err), err.Error())
+		return
+	}
+
+	writeResponse(w, res)
+`))
+
+	errorStatusTpl = template.Must(template.New("errorStatusTpl").Parse(`
+// statusClientClosedRequest is the non-standard status of requests
+// which were canceled by the client before the response was written
+const statusClientClosedRequest = 499
+
+// errorStatus returns the HTTP status of an error returned by a method,
+// errors and the ones they wrap may have method HTTPStatus() int
+{{- if .Type}} or be {{.Type}}{{end}}
+func errorStatus(err error) int {
+	var statusErr interface{ HTTPStatus() int }
+	{{- with .Type}}
+	var apiErr {{.}}
+	{{- end}}
+	switch {
+	case errors.As(err, &statusErr):
+		return statusErr.HTTPStatus()
+	{{- with .Type}}
+	case errors.As(err, &apiErr):
+		return apiErr.HTTPStatus
+	{{- end}}
+	case errors.Is(err, context.Canceled):
+		return statusClientClosedRequest
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	}
+
+	return http.StatusInternalServerError
+}
+`))
+
+	envelopeTpl = template.Must(template.New("envelopeTpl").Parse(`
+// writeError writes the error in the {"error": ...} envelope
+func writeError(w http.ResponseWriter, status int, message string) {
+	response, _ := json.Marshal(&Response{
+		"error": message,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// writeResponse writes the result in the {"error": "", "response": ...} envelope
+func writeResponse(w http.ResponseWriter, res interface{}) {
+	response, _ := json.Marshal(&Response{
+		"error":    "",
+		"response": res,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+`))
+
+	problemTpl = template.Must(template.New("problemTpl").Parse(`
+// Problem is the RFC 7807 description of an error
+type Problem struct {
+	Type   string ` + "`" + `json:"type"` + "`" + `
+	Title  string ` + "`" + `json:"title"` + "`" + `
+	Status int    ` + "`" + `json:"status"` + "`" + `
+	Detail string ` + "`" + `json:"detail,omitempty"` + "`" + `
+}
+
+// writeError writes the error as application/problem+json
+func writeError(w http.ResponseWriter, status int, message string) {
+	response, _ := json.Marshal(&Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: message,
+	})
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// writeResponse writes the result as is
+func writeResponse(w http.ResponseWriter, res interface{}) {
+	response, _ := json.Marshal(res)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+`))
+)
+
+// generator writes the handlers of a package into a buffer,
+// imports are collected along the way and written in front of the code
+type generator struct {
+	opts    options
+	pkg     *types.Package
+	out     bytes.Buffer
+	imports map[string]string
+
+	// required are the helpers used by the generated handlers
+	required map[*template.Template]bool
+	// collect is set while the params of an endpoint collecting
+	// errors of all fields are written
+	collect bool
+	// patterns are the regexps of pattern rules compiled at package init
+	patterns []string
+	// standalone is set for the files generated next to the handlers,
+	// like clients and tests, they don't declare the types of the handlers
+	standalone bool
+}
+
+func newGenerator(opts options, pkg *types.Package) *generator {
+	g := &generator{
+		opts:     opts,
+		pkg:      pkg,
+		imports:  make(map[string]string),
+		required: make(map[*template.Template]bool),
+	}
+	g.use("net/http")
+	g.use("fmt")
+	g.use("encoding/json")
+	g.use("errors")
+	g.use("io")
+	g.use("mime")
+	g.use("strings")
+
+	return g
+}
+
+// newStandaloneGenerator returns the generator of a file written next
+// to the handlers into the same package, like the file of the clients
+func newStandaloneGenerator(opts options, pkg *types.Package) *generator {
+	return &generator{
+		opts:       opts,
+		pkg:        pkg,
+		imports:    make(map[string]string),
+		required:   make(map[*template.Template]bool),
+		standalone: true,
+	}
+}
+
+// use adds the package to the imports of the generated file and returns
+// the name it should be referred by
+func (g *generator) use(path string) string {
+	if name, exists := g.imports[path]; exists {
+		return name
+	}
+
+	name := path[strings.LastIndex(path, "/")+1:]
+	if imported := g.importedPackage(path); imported != nil {
+		name = imported.Name()
+	}
+
+	base := name
+	for i := 2; g.nameTaken(name); i++ {
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	g.imports[path] = name
+
+	return name
+}
+
+func (g *generator) importedPackage(path string) *types.Package {
+	for _, imported := range g.pkg.Imports() {
+		if imported.Path() == path {
+			return imported
+		}
+	}
+
+	return nil
+}
+
+func (g *generator) nameTaken(name string) bool {
+	for _, taken := range g.imports {
+		if taken == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fail returns the statement failing the validation of the field, it replies
+// with the error or, if errors are collected, returns it from the field check
+func (g *generator) fail(field, rule, message string) string {
+	return g.failWith(field, rule, strconv.Quote(message))
+}
+
+// failWith is fail with the message taken from a Go expression
+func (g *generator) failWith(field, rule, message string) string {
+	if g.collect {
+		return fmt.Sprintf("return &FieldError{Field: %q, Rule: %q, Message: %s}", field, rule, message)
+	}
+
+	return fmt.Sprintf("writeError(w, http.StatusBadRequest, %s)\nreturn", message)
+}
+
+// pattern returns the name of the var keeping the compiled pattern
+func (g *generator) pattern(pattern string) string {
+	for i, known := range g.patterns {
+		if known == pattern {
+			return fmt.Sprintf("pattern%d", i)
+		}
+	}
+	g.patterns = append(g.patterns, pattern)
+
+	return fmt.Sprintf("pattern%d", len(g.patterns)-1)
+}
+
+// require marks the helper to be written into the generated file
+func (g *generator) require(helper *template.Template) {
+	g.required[helper] = true
+}
+
+func (g *generator) qualifier(pkg *types.Package) string {
+	if pkg == g.pkg {
+		return ""
+	}
+
+	return g.use(pkg.Path())
+}
+
+func (g *generator) typeString(t types.Type) string {
+	return types.TypeString(t, g.qualifier)
+}
+
+// source returns the formatted code of the generated file, if it can't be
+// formatted the unformatted code is returned along with the error
+func (g *generator) source() ([]byte, error) {
+	paths := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var src bytes.Buffer
+	fmt.Fprintln(&src, "// Code generated by handlers_gen; DO NOT EDIT.")
+	fmt.Fprintln(&src)
+	fmt.Fprintln(&src, `package `+g.pkg.Name())
+	fmt.Fprintln(&src)
+	fmt.Fprintln(&src, `import (`)
+	for _, path := range paths {
+		name := g.imports[path]
+		if name == path[strings.LastIndex(path, "/")+1:] {
+			fmt.Fprintf(&src, "\t%q\n", path)
+			continue
+		}
+		fmt.Fprintf(&src, "\t%s %q\n", name, path)
+	}
+	fmt.Fprintln(&src, `)`)
+	fmt.Fprintln(&src)
+	if !g.standalone {
+		fmt.Fprintln(&src, `type Response map[string]interface{}`)
+	}
+	src.Write(g.out.Bytes())
+
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return src.Bytes(), err
+	}
+
+	return formatted, nil
+}
+
+func (g *generator) service(srv *service) {
+	out := &g.out
+
+	// endpoints sharing a url are routed by the method
+	var groups, routes [][]*endpoint
+	byURL := make(map[string]int)
+	for _, ep := range srv.Endpoints {
+		i, exists := byURL[ep.Spec.URL]
+		if !exists {
+			i = len(groups)
+			byURL[ep.Spec.URL] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], ep)
+	}
+	for _, group := range groups {
+		if group[0].Route != nil {
+			routes = append(routes, group)
+		}
+	}
+
+	if len(routes) != 0 {
+		g.use("regexp")
+		g.use("net/url")
+		g.require(pathUnescapeTpl)
+		fmt.Fprint(out, "\nvar (")
+		for _, group := range routes {
+			routeVarTpl.Execute(out, tpl{
+				FieldName: routeVarName(srv, group[0]),
+				Path:      group[0].Route.Pattern,
+			})
+		}
+		fmt.Fprintln(out, "\n)")
+	}
+
+	routerTpl.Execute(out, tpl{
+		StructName: srv.Name,
+	})
+	for _, ep := range srv.Endpoints {
+		fmt.Fprintf(out, "\t%s http.Handler\n", handlerFieldName(ep))
+	}
+	newRouterTpl.Execute(out, tpl{
+		StructName: srv.Name,
+	})
+	for _, ep := range srv.Endpoints {
+		handler := "http.HandlerFunc(srv." + ep.Name + "Wrapper)"
+		for i := len(ep.Middleware) - 1; i >= 0; i-- {
+			name := ep.Middleware[i].Name
+			if ep.Middleware[i].Method {
+				name = "srv." + name
 			}
-			fmt.Fprintln(out)
-
-			for _, param := range methodName.Type.Params.List{
-				paramName := fmt.Sprintf("%s", param.Type)
-
-				for name, fields := range findStructs {
-					if name != paramName {
-						log.Println(name, "!=", paramName)
-						continue
-					}
-
-					fmt.Fprintln(out, "	output := " + paramName + "{}")
-
-					for _, field := range fields {
-						fieldName := field.Names[0].Name
-						tag := reflect.StructTag(field.Tag.Value[1:len(field.Tag.Value)-1]).Get("apivalidator")
-						lowCaseFieldName := strings.ToLower(fieldName)
-						matched, _ := regexp.MatchString("paramname=", tag)
-						if matched {
-							s := regexp.MustCompile(`paramname=[^,]*`).FindString(tag)
-							lowCaseFieldName = regexp.MustCompile("=").Split(s, -1)[1]
-						}
-
-						fieldType := field.Type.(*ast.Ident).Name
-
-						switch fieldType {
-						case "string":
-							paramStringTpl.Execute(out, tpl{
-								ParamName: fieldName,
-								Param:     lowCaseFieldName,
-							})
-						case "int":
-							paramIntTpl.Execute(out, tpl{
-								ParamName: fieldName,
-								Param:     lowCaseFieldName,
-							})
-
-						}
-
-						matched, _ = regexp.MatchString("required", tag)
-						if matched {
-							checkForRequestParamTpl.Execute(out, tpl{
-								ParamName: fieldName,
-								Param:     lowCaseFieldName,
-							})
-						}
-
-						matched, _ = regexp.MatchString("min=", tag)
-						if matched {
-							s := regexp.MustCompile(`min=[^,]*`).FindString(tag)
-							min := regexp.MustCompile("=").Split(s, -1)[1]
-
-							switch fieldType {
-							case "string":
-								checkForMinimumLenTpl.Execute(out, tpl{
-									ParamName: fieldName,
-									Param:     lowCaseFieldName,
-									Min:       min,
-								})
-							case "int":
-								checkForMinimumNumberTpl.Execute(out, tpl{
-									ParamName: fieldName,
-									Param:     lowCaseFieldName,
-									Min:       min,
-								})
-
-							}
-						}
-
-						matched, _ = regexp.MatchString("max=", tag)
-						if matched {
-							s := regexp.MustCompile(`max=[^,]*`).FindString(tag)
-							max := regexp.MustCompile("=").Split(s, -1)[1]
-
-							switch fieldType {
-							case "string":
-								checkForMaximumLenTpl.Execute(out, tpl{
-									ParamName: fieldName,
-									Param:     lowCaseFieldName,
-									Max:       max,
-								})
-							case "int":
-								checkForMaximumNumberTpl.Execute(out, tpl{
-									ParamName: fieldName,
-									Param:     lowCaseFieldName,
-									Max:       max,
-								})
-
-							}
-						}
-
-						matched, _ = regexp.MatchString("enum=", tag)
-						if matched {
-
-							enumSwitchTpl.Execute(out, tpl{
-								ParamName: fieldName,
-							})
-
-							s := regexp.MustCompile(`enum=[^,]*`).FindString(tag)
-							unparsedEnums := regexp.MustCompile("=").Split(s, -1)[1]
-							enums := regexp.MustCompile("[|]").Split(unparsedEnums, -1)
-							for _, enum := range enums {
-								enumCaseTpl.Execute(out, tpl{
-									Enum: enum,
-								})
-							}
-
-							joinedEnums := "[" + strings.Join(enums, ", ") + "]"
-							s = regexp.MustCompile(`default=[^,]*`).FindString(tag)
-							dflt := regexp.MustCompile("=").Split(s, -1)[1]
-							enumDefaultTpl.Execute(out, tpl{
-								ParamName: fieldName,
-								Param: lowCaseFieldName,
-								Enums: joinedEnums,
-								Dflt: dflt,
-							})
-						}
-					}
-				}
-			}
-			resultTpl.Execute(out, tpl{
-				MethodName: methodName.Name.Name,
+			handler = name + "(" + handler + ")"
+		}
+		fmt.Fprintf(out, "\trt.%s = %s\n", handlerFieldName(ep), handler)
+	}
+	g.use("sync")
+	useTpl.Execute(out, tpl{
+		FieldName:  strings.ToLower(srv.Name[:1]) + srv.Name[1:] + "Routers",
+		StructName: srv.Name,
+	})
+
+	srvHTTPTpl.Execute(out, tpl{
+		StructName: srv.Name,
+	})
+	switchTpl.Execute(out, tpl{
+		SwitchName: srv.Name + "Switch",
+	})
+
+	for _, group := range groups {
+		if group[0].Route != nil {
+			continue
+		}
+		caseTpl.Execute(out, tpl{
+			Path: group[0].Spec.URL,
+		})
+		g.dispatch(srv, group)
+	}
+
+	fmt.Fprint(out, "\n	default:")
+	for _, group := range routes {
+		routeMatchTpl.Execute(out, tpl{
+			FieldName: routeVarName(srv, group[0]),
+		})
+		for _, param := range group[0].Route.Params {
+			routeParamTpl.Execute(out, tpl{
+				Param: param.Name,
+				Index: param.Index,
+			})
+		}
+		g.dispatch(srv, group)
+		routeReturnTpl.Execute(out, tpl{})
+	}
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, `		writeError(w, http.StatusNotFound, "unknown method")`)
+	fmt.Fprintln(out, "	}\n}")
+
+	for _, ep := range srv.Endpoints {
+		g.wrapper(srv, ep)
+	}
+}
+
+// dispatch writes the call of the handler of the endpoints serving a url,
+// if there are several of them it is chosen by the method of the request
+func (g *generator) dispatch(srv *service, group []*endpoint) {
+	out := &g.out
+
+	if len(group) == 1 {
+		handlerCallTpl.Execute(out, tpl{
+			FieldName: handlerFieldName(group[0]),
+		})
+		return
+	}
+
+	g.require(replyAllowTpl)
+	methodSwitchTpl.Execute(out, tpl{})
+	for _, ep := range group {
+		methodCaseTpl.Execute(out, tpl{
+			Methods:   quoteList(ep.Spec.Methods),
+			FieldName: handlerFieldName(ep),
+		})
+	}
+	methodDefaultTpl.Execute(out, tpl{
+		Allow: allowHeader(srv.urlMethods(group[0].Spec.URL)),
+	})
+}
+
+// allowHeader returns the Allow header of a url served with the methods,
+// OPTIONS is always allowed
+func allowHeader(methods []string) string {
+	if len(methods) == 0 {
+		methods = httpMethods
+	}
+
+	return strings.Join(append(methods[:len(methods):len(methods)], http.MethodOptions), ", ")
+}
+
+// handlerFieldName is the name of the router field
+// keeping the handler of the endpoint
+func handlerFieldName(ep *endpoint) string {
+	return strings.ToLower(ep.Name[:1]) + ep.Name[1:] + "Handler"
+}
+
+// routeVarName is the name of the regexp matching the route of the endpoint
+func routeVarName(srv *service, ep *endpoint) string {
+	return strings.ToLower(srv.Name[:1]) + srv.Name[1:] + ep.Name + "Route"
+}
+
+func (g *generator) wrapper(srv *service, ep *endpoint) {
+	out := &g.out
+
+	wrapperTpl.Execute(out, tpl{
+		WrapperName: ep.Name + "Wrapper",
+		StructName:  srv.Name,
+		MethodName:  ep.Name,
+	})
+
+	// the methods of all endpoints serving the url are allowed
+	methodTpl.Execute(out, tpl{
+		Allow:   allowHeader(srv.urlMethods(ep.Spec.URL)),
+		Methods: quoteList(ep.Spec.Methods),
+	})
+
+	if ep.Spec.Auth != nil {
+		g.auth(ep.Spec.Auth)
+		g.authorize(ep.Spec)
+	}
+
+	// path params are never sent in the body
+	hasBodyFields := false
+	for _, f := range ep.Params.Fields {
+		hasBodyFields = hasBodyFields || f.Rules.Source != "path"
+	}
+	wrapperParamsTpl.Execute(out, tpl{
+		Type:   g.typeString(ep.Params.Type),
+		Fields: hasBodyFields,
+	})
+
+	g.collect = ep.Spec.Errors == "all" && len(ep.Params.Fields) != 0
+	if g.collect {
+		g.require(fieldErrorsTpl)
+		fmt.Fprintln(out, "\n	var fieldErrors []FieldError")
+	}
+
+	for _, f := range ep.Params.Fields {
+		g.field(f)
+	}
+	g.crossChecks(ep.Params.Fields)
+
+	if g.collect {
+		collectReplyTpl.Execute(out, tpl{})
+		g.collect = false
+	}
+
+	if ep.Params.Validate {
+		validateTpl.Execute(out, tpl{})
+	}
+
+	resultTpl.Execute(out, tpl{
+		MethodName: ep.Name,
+	})
+	fmt.Fprintln(out, "}")
+}
+
+// auth writes the authentication of the request by the strategy,
+// the principal is passed to the method in the request context
+func (g *generator) auth(auth *authSpec) {
+	g.use("context")
+	g.require(principalTpl)
+
+	var source, challenge string
+	switch auth.Type {
+	case "token":
+		g.require(authTokenTpl)
+		source = fmt.Sprintf("authToken(r, %q, %q)", auth.Header, auth.Env)
+	case "bearer":
+		g.require(authBearerTpl)
+		source = fmt.Sprintf("authBearer(r, %q)", auth.Env)
+		challenge = "Bearer"
+	case "basic":
+		g.require(authBasicTpl)
+		source = fmt.Sprintf("authBasic(r, %q)", auth.Env)
+		challenge = `Basic realm="api"`
+	case "apikey":
+		g.require(authAPIKeyTpl)
+		source = fmt.Sprintf("authAPIKey(r, %q, %q, %q)", auth.Header, auth.Query, auth.Env)
+	case "method":
+		source = "srv.Authenticate(r.Context(), r)"
+	}
+	if auth.Type != "method" {
+		g.use("crypto/subtle")
+		g.use("os")
+		g.require(staticAuthTpl)
+	}
+
+	authTpl.Execute(&g.out, tpl{
+		Source:    source,
+		Challenge: challenge,
+	})
+}
+
+// authorize writes the checks of the principal roles and scopes
+func (g *generator) authorize(spec *apiSpec) {
+	if spec.Roles != nil {
+		g.require(checkRolesTpl)
+		authorizeTpl.Execute(&g.out, tpl{
+			Source: "checkRoles(principal.Roles(), " + quoteList(spec.Roles) + ")",
+		})
+	}
+
+	if spec.Scopes != nil {
+		g.require(checkScopesTpl)
+		authorizeTpl.Execute(&g.out, tpl{
+			Source: "checkScopes(principal.Scopes(), " + quoteList(spec.Scopes) + ")",
+		})
+	}
+}
+
+// quoteList returns the strings as a list of Go literals
+func quoteList(list []string) string {
+	quoted := make([]string, len(list))
+	for i, s := range list {
+		quoted[i] = strconv.Quote(s)
+	}
+
+	return strings.Join(quoted, ", ")
+}
+
+func (g *generator) field(f *field) {
+	value := "output." + f.Name
+
+	if f.Fields != nil {
+		g.structField(f, value)
+		return
+	}
+
+	g.check(func() {
+		g.fieldValue(f, value)
+	})
+}
+
+// check writes the code of a single field with its checks, if errors
+// are collected it is run in a func returning the error of the field
+func (g *generator) check(write func()) {
+	if !g.collect {
+		write()
+		return
+	}
+
+	collectStartTpl.Execute(&g.out, tpl{})
+	write()
+	collectEndTpl.Execute(&g.out, tpl{})
+}
+
+// fieldValue writes the code filling the field from the request and checking it
+func (g *generator) fieldValue(f *field, value string) {
+	out := &g.out
+
+	if f.Rules.Source == "path" {
+		// placeholders are matched by the router, so they are never empty
+		g.parse(f, value, `r.PathValue("`+f.Param+`")`)
+		fmt.Fprintln(out)
+		g.fieldChecks(f, value)
+		return
+	}
+
+	// JSON body is already decoded into output,
+	// so only the values sent in a form have to be parsed
+	fmt.Fprint(out, "\n	if !fromJSON {")
+	switch {
+	case f.Slice:
+		g.require(formValuesTpl)
+		sliceParamTpl.Execute(out, tpl{
+			Param: f.Param,
+			Type:  g.typeString(f.Elem),
+			CSV:   f.Rules.CSV,
+		})
+		g.parse(f, "item", "value")
+		sliceAppendTpl.Execute(out, tpl{
+			Value: value,
+		})
+	case f.Ptr:
+		// pointers are left nil if the param is not sent at all
+		g.require(formValuesTpl)
+		g.require(formValueTpl)
+		ptrParamTpl.Execute(out, tpl{
+			Param: f.Param,
+			Type:  g.typeString(f.Type),
+		})
+		g.parse(f, "item", "value")
+		ptrAssignTpl.Execute(out, tpl{
+			Value: value,
+		})
+	case f.Kind == "string":
+		g.parse(f, value, `r.FormValue("`+f.Param+`")`)
+	default:
+		// empty value is the same as not sent one and leaves the zero value
+		numberParamTpl.Execute(out, tpl{
+			Param: f.Param,
+		})
+		g.parse(f, value, "value")
+		if isFormDefault(f) {
+			formDefaultTpl.Execute(out, tpl{
+				Value: value,
+				Dflt:  f.Default[0],
+			})
+		} else {
+			fmt.Fprint(out, "\n		}")
+		}
+	}
+	fmt.Fprintln(out, "\n	}")
+
+	g.fieldChecks(f, value)
+}
+
+// isFormDefault reports whether the default of the field is set when its
+// form param is absent, false of a bool can't be told from the zero value,
+// so JSON bodies need *bool to get the default
+func isFormDefault(f *field) bool {
+	return f.Default != nil && f.Kind == "bool" && !f.Ptr && !f.Slice
+}
+
+// fieldChecks writes the checks of the field value after it is filled
+func (g *generator) fieldChecks(f *field, value string) {
+	out := &g.out
+
+	zero := zeroValue(f.Kind)
+	switch {
+	case f.Ptr:
+		zero = "nil"
+	case f.Slice:
+		zero = ""
+	}
+
+	g.normalize(f, value)
+
+	switch {
+	case f.Default == nil || isFormDefault(f):
+	case f.Ptr:
+		ptrDefaultTpl.Execute(out, tpl{
+			FieldName: strings.ReplaceAll(f.Name, ".", ""),
+			Value:     value,
+			Type:      g.typeString(f.Type),
+			Dflt:      f.Default[0],
+		})
+	case f.Slice:
+		defaultTpl.Execute(out, tpl{
+			Source: isZero(f, value),
+			Value:  value,
+			Dflt:   g.typeString(f.Type) + "{" + strings.Join(f.Default, ", ") + "}",
+		})
+	default:
+		defaultTpl.Execute(out, tpl{
+			Source: isZero(f, value),
+			Value:  value,
+			Dflt:   f.Default[0],
+		})
+	}
+
+	if f.Rules.Required {
+		checkForRequestParamTpl.Execute(out, tpl{
+			Fail:  g.fail,
+			Value: value,
+			Param: f.Param,
+			Zero:  zero,
+		})
+	}
+
+	switch {
+	case f.Slice:
+		if hasValueChecks(f) {
+			fmt.Fprint(out, "\n	for _, item := range "+value+" {")
+			g.valueChecks(f, "item")
+			fmt.Fprintln(out, "\n	}")
+		}
+		g.sliceChecks(f, value)
+	case f.Ptr:
+		if hasValueChecks(f) {
+			fmt.Fprint(out, "\n	if "+value+" != nil {")
+			g.valueChecks(f, "*"+value)
+			fmt.Fprintln(out, "\n	}")
+		}
+	default:
+		g.valueChecks(f, value)
+	}
+
+	if v := f.Validator; v != nil {
+		source := v.Name
+		if v.Method {
+			source = "srv." + v.Name
+		}
+		validatorTpl.Execute(out, tpl{
+			Fail:   g.failWith,
+			Source: source,
+			Value:  value,
+			Param:  f.Param,
+			Ptr:    v.Elem,
+		})
+	}
+}
+
+// normalize writes the normalizers of a string field,
+// for slices they are applied to every item
+func (g *generator) normalize(f *field, value string) {
+	if !f.Rules.Trim && !f.Rules.Lowercase {
+		return
+	}
+	out := &g.out
+
+	target := value
+	switch {
+	case f.Ptr:
+		fmt.Fprint(out, "\n	if "+value+" != nil {")
+		target = "*" + value
+	case f.Slice:
+		fmt.Fprint(out, "\n	for i := range "+value+" {")
+		target = value + "[i]"
+	}
+
+	expr, conv := g.asString(f, target)
+	if f.Rules.Trim {
+		expr = "strings.TrimSpace(" + expr + ")"
+	}
+	if f.Rules.Lowercase {
+		expr = "strings.ToLower(" + expr + ")"
+	}
+	paramStringTpl.Execute(out, tpl{
+		Value:  target,
+		Source: expr,
+		Conv:   conv,
+	})
+
+	if f.Ptr || f.Slice {
+		fmt.Fprint(out, "\n	}")
+	}
+	fmt.Fprintln(out)
+}
+
+// asString returns the value of a string field converted to string
+// and the type to convert the string back to if the field type is named
+func (g *generator) asString(f *field, value string) (string, string) {
+	t := f.Type
+	if f.Slice {
+		t = f.Elem
+	}
+
+	typeName := g.typeString(t)
+	if typeName == "string" {
+		return value, ""
+	}
+
+	return "string(" + value + ")", typeName
+}
+
+// hasValueChecks reports whether valueChecks writes any checks of the field,
+// they are applied to every item of a slice and to the value of a pointer
+func hasValueChecks(f *field) bool {
+	r := f.Rules
+	return r.Min != "" || r.Max != "" || len(r.Enum) != 0 || r.Pattern != "" || r.Format != ""
+}
+
+// structField writes the code filling and checking the fields of a nested struct,
+// pointers to structs are allocated only if any of their fields is sent
+func (g *generator) structField(f *field, value string) {
+	out := &g.out
+
+	if f.Ptr {
+		g.require(formHasPrefixTpl)
+		ptrStructTpl.Execute(out, tpl{
+			Value: value,
+			Param: f.Param,
+			Type:  g.typeString(f.Type),
+		})
+
+		if f.Rules.Required {
+			g.check(func() {
+				checkForRequestParamTpl.Execute(out, tpl{
+					Fail:  g.fail,
+					Value: value,
+					Param: f.Param,
+					Zero:  "nil",
+				})
+			})
+		}
+
+		fmt.Fprint(out, "\n	if "+value+" != nil {")
+	}
+
+	for _, child := range f.Fields {
+		g.field(child)
+	}
+	g.crossChecks(f.Fields)
+
+	if f.Ptr {
+		fmt.Fprintln(out, "\n	}")
+	}
+}
+
+// crossChecks writes the cross-field rules of the fields of a struct
+// in the order of the fields
+func (g *generator) crossChecks(fields []*field) {
+	for _, f := range fields {
+		value := "output." + f.Name
+		var checks []tpl
+
+		if ref := f.RequiredIf; ref != nil {
+			set, refValue := deref(ref)
+			checks = append(checks, tpl{
+				Source:  joinConds(set, refValue+" == "+literal(ref.Kind, f.Rules.RequiredIfValue), isZero(f, value)),
+				Rule:    "required_if",
+				Message: fmt.Sprintf("%s is required when %s is %s", f.Param, ref.Param, f.Rules.RequiredIfValue),
+			})
+		}
+		if ref := f.RequiredWithout; ref != nil {
+			checks = append(checks, tpl{
+				Source:  joinConds(isZero(ref, "output."+ref.Name), isZero(f, value)),
+				Rule:    "required_without",
+				Message: fmt.Sprintf("%s is required when %s is not set", f.Param, ref.Param),
+			})
+		}
+		if ref := f.EqField; ref != nil {
+			set, fieldValue := deref(f)
+			refSet, refValue := deref(ref)
+			checks = append(checks, tpl{
+				Source:  joinConds(set, refSet, fieldValue+" != "+refValue),
+				Rule:    "eqfield",
+				Message: fmt.Sprintf("%s must be equal to %s", f.Param, ref.Param),
+			})
+		}
+		if ref := f.GtField; ref != nil {
+			set, fieldValue := deref(f)
+			refSet, refValue := deref(ref)
+			checks = append(checks, tpl{
+				Source:  joinConds(set, refSet, fieldValue+" <= "+refValue),
+				Rule:    "gtfield",
+				Message: fmt.Sprintf("%s must be greater than %s", f.Param, ref.Param),
+			})
+		}
+
+		for _, check := range checks {
+			check.Fail = g.fail
+			check.Param = f.Param
+			g.check(func() {
+				crossFieldTpl.Execute(&g.out, check)
+			})
+		}
+	}
+}
+
+// deref returns the condition of a pointer field being set
+// and the expression of its value
+func deref(f *field) (string, string) {
+	value := "output." + f.Name
+	if f.Ptr {
+		return value + " != nil", "*" + value
+	}
+
+	return "", value
+}
+
+// isZero returns the condition of the field not being sent
+func isZero(f *field, value string) string {
+	switch {
+	case f.Ptr:
+		return value + " == nil"
+	case f.Slice:
+		return "len(" + value + ") == 0"
+	}
+
+	return value + " == " + zeroValue(f.Kind)
+}
+
+// joinConds joins non-empty conditions with &&
+func joinConds(conds ...string) string {
+	var nonEmpty []string
+	for _, cond := range conds {
+		if cond != "" {
+			nonEmpty = append(nonEmpty, cond)
+		}
+	}
+
+	return strings.Join(nonEmpty, " && ")
+}
+
+// parse writes the code converting the string source expression
+// into the value of the field type, for slices it is the type of an item
+func (g *generator) parse(f *field, value, source string) {
+	out := &g.out
+
+	t := f.Type
+	if f.Slice {
+		t = f.Elem
+	}
+	typeName := g.typeString(t)
+
+	kind := kinds[f.Kind]
+	if kind.Parser == "" {
+		conv := ""
+		if typeName != f.Kind {
+			conv = typeName
+		}
+		paramStringTpl.Execute(out, tpl{
+			Value:  value,
+			Source: source,
+			Conv:   conv,
+		})
+		return
+	}
+
+	// durations are parsed like their defaults
+	if isDuration(t) {
+		g.use("time")
+		paramDurationTpl.Execute(out, tpl{
+			Fail:      g.fail,
+			FieldName: strings.ReplaceAll(strings.TrimPrefix(value, "output."), ".", ""),
+			Value:     value,
+			Source:    source,
+			Param:     f.Param,
+		})
+		return
+	}
+
+	parseArgs := ""
+	switch kind.Parser {
+	case "ParseInt", "ParseUint":
+		parseArgs = fmt.Sprintf(", 10, %d", kind.Bits)
+	case "ParseFloat":
+		parseArgs = fmt.Sprintf(", %d", kind.Bits)
+	}
+	g.use("strconv")
+
+	paramNumberTpl.Execute(out, tpl{
+		Fail:      g.fail,
+		FieldName: strings.ReplaceAll(strings.TrimPrefix(value, "output."), ".", ""),
+		Value:     value,
+		Source:    source,
+		Param:     f.Param,
+		Type:      typeName,
+		Kind:      f.Kind,
+		Parser:    kind.Parser,
+		ParseArgs: parseArgs,
+	})
+}
+
+// valueChecks writes min, max and enum checks of a single value,
+// for slices they are applied to every item
+func (g *generator) valueChecks(f *field, value string) {
+	out := &g.out
+
+	if f.Rules.Min != "" {
+		switch f.Kind {
+		case "string":
+			checkForMinimumLenTpl.Execute(out, tpl{
+				Fail:  g.fail,
+				Value: value,
+				Param: f.Param,
+				Min:   f.Rules.Min,
+			})
+		default:
+			checkForMinimumNumberTpl.Execute(out, tpl{
+				Fail:  g.fail,
+				Value: value,
+				Param: f.Param,
+				Min:   f.Rules.Min,
+			})
+		}
+	}
+
+	if f.Rules.Max != "" {
+		switch f.Kind {
+		case "string":
+			checkForMaximumLenTpl.Execute(out, tpl{
+				Fail:  g.fail,
+				Value: value,
+				Param: f.Param,
+				Max:   f.Rules.Max,
+			})
+		default:
+			checkForMaximumNumberTpl.Execute(out, tpl{
+				Fail:  g.fail,
+				Value: value,
+				Param: f.Param,
+				Max:   f.Rules.Max,
 			})
-			fmt.Fprintln(out, "\n}")
 		}
 	}
-	checkRequestMethod.Execute(out, tpl{})
-	checkAuth.Execute(out, tpl{})
+
+	if f.Rules.Pattern != "" {
+		str, _ := g.asString(f, value)
+		checkForPatternTpl.Execute(out, tpl{
+			Fail:      g.fail,
+			FieldName: g.pattern(f.Rules.Pattern),
+			Value:     value,
+			Source:    str,
+			Param:     f.Param,
+			Path:      f.Rules.Pattern,
+		})
+	}
+
+	if f.Rules.Format != "" {
+		format := formatHelpers[f.Rules.Format]
+		g.use(format.Import)
+		g.require(format.Tpl)
+
+		str, _ := g.asString(f, value)
+		checkForFormatTpl.Execute(out, tpl{
+			Fail:      g.fail,
+			FieldName: format.Func,
+			Value:     value,
+			Source:    str,
+			Param:     f.Param,
+			Kind:      f.Rules.Format,
+		})
+	}
+
+	if len(f.Rules.Enum) != 0 {
+		enumSwitchTpl.Execute(out, tpl{
+			Value: value,
+			Zero:  zeroValue(f.Kind),
+		})
+
+		for _, enum := range f.Rules.Enum {
+			enumCaseTpl.Execute(out, tpl{
+				Enum: literal(f.Kind, enum),
+			})
+		}
+
+		enumDefaultTpl.Execute(out, tpl{
+			Fail:  g.fail,
+			Value: value,
+			Param: f.Param,
+			Enums: "[" + strings.Join(f.Rules.Enum, ", ") + "]",
+		})
+	}
+}
+
+// sliceChecks writes the checks of the whole collection
+func (g *generator) sliceChecks(f *field, value string) {
+	out := &g.out
+
+	if f.Rules.MinItems != "" {
+		checkForMinimumItemsTpl.Execute(out, tpl{
+			Fail:  g.fail,
+			Value: value,
+			Param: f.Param,
+			Min:   f.Rules.MinItems,
+		})
+	}
+
+	if f.Rules.MaxItems != "" {
+		checkForMaximumItemsTpl.Execute(out, tpl{
+			Fail:  g.fail,
+			Value: value,
+			Param: f.Param,
+			Max:   f.Rules.MaxItems,
+		})
+	}
+
+	if f.Rules.Unique {
+		checkForUniqueItemsTpl.Execute(out, tpl{
+			Fail:      g.fail,
+			FieldName: strings.ReplaceAll(f.Name, ".", ""),
+			Value:     value,
+			Param:     f.Param,
+			Type:      g.typeString(f.Elem),
+		})
+	}
+}
+
+// zeroValue returns the literal of the zero value of the basic type
+func zeroValue(kind string) string {
+	switch kind {
+	case "string":
+		return `""`
+	case "bool":
+		return "false"
+	}
+
+	return "0"
+}
+
+// formatHelper is the func checking the format and the helper declaring it,
+// Sample is a valid value sent by the generated tests
+type formatHelper struct {
+	Func   string
+	Tpl    *template.Template
+	Import string
+	Sample string
+}
+
+var formatHelpers = map[string]formatHelper{
+	"email":     {Func: "isEmail", Tpl: formatEmailTpl, Import: "net/mail", Sample: "user@example.com"},
+	"uuid":      {Func: "isUUID", Tpl: formatUUIDTpl, Import: "regexp", Sample: "123e4567-e89b-12d3-a456-426614174000"},
+	"url":       {Func: "isURL", Tpl: formatURLTpl, Import: "net/url", Sample: "https://example.com"},
+	"ipv4":      {Func: "isIPv4", Tpl: formatIPv4Tpl, Import: "net/netip", Sample: "127.0.0.1"},
+	"date-time": {Func: "isDateTime", Tpl: formatDateTimeTpl, Import: "time", Sample: "2006-01-02T15:04:05Z"},
+}
+
+// optionalHelpers are the helpers written only if they are used,
+// in the order they are written
+var optionalHelpers = []*template.Template{
+	pathUnescapeTpl, formValuesTpl, formValueTpl, formHasPrefixTpl,
+	replyAllowTpl, principalTpl, staticAuthTpl, authTokenTpl, authBearerTpl, authBasicTpl, authAPIKeyTpl,
+	checkRolesTpl, checkScopesTpl, fieldErrorsTpl,
+	formatEmailTpl, formatUUIDTpl, formatURLTpl, formatIPv4Tpl, formatDateTimeTpl,
+}
+
+func (g *generator) helpers() {
+	g.use("log")
+	g.use("runtime/debug")
+	if g.opts.RequestID != "" {
+		g.use("crypto/rand")
+		g.use("encoding/hex")
+	}
+	recoverPanicTpl.Execute(&g.out, tpl{
+		Param: g.opts.RequestID,
+	})
+
+	switch g.opts.Envelope {
+	case "problem":
+		problemTpl.Execute(&g.out, tpl{})
+	default:
+		envelopeTpl.Execute(&g.out, tpl{})
+	}
+
+	g.use("context")
+	apiErr := ""
+	if named := apiErrorType(g.pkg); named != nil {
+		apiErr = g.typeString(named)
+	}
+	errorStatusTpl.Execute(&g.out, tpl{
+		Type: apiErr,
+	})
+
+	checkRequestMethod.Execute(&g.out, tpl{})
+	bindJSONTpl.Execute(&g.out, tpl{
+		MaxBody: g.opts.MaxBody,
+	})
+	if len(g.patterns) != 0 {
+		g.use("regexp")
+		patternsTpl.Execute(&g.out, g.patterns)
+	}
+
+	for _, helper := range optionalHelpers {
+		if g.required[helper] {
+			helper.Execute(&g.out, tpl{
+				Kind: g.opts.Envelope,
+			})
+		}
+	}
+}
+
+// options are the generator settings given in the command line
+type options struct {
+	MaxBody int64
+	// RequestID is the header of request ids, if it is set panics
+	// are replied with the id instead of the panic message
+	RequestID string
+	// Envelope is the format of responses, see envelopes
+	Envelope string
+}
+
+// envelopes are the formats of responses, default wraps errors and results
+// into {"error": ..., "response": ...}, problem writes errors as RFC 7807
+// application/problem+json and results as they are
+var envelopes = []string{"default", "problem"}
+
+// langs are the languages of the output, go writes the handlers
+// and ts writes the TypeScript client of the services instead
+var langs = []string{"go", "ts"}
+
+// handlersSource returns the code of the handlers of the services
+func handlersSource(opts options, pkg *types.Package, services []*service) ([]byte, error) {
+	g := newGenerator(opts, pkg)
+	for _, srv := range services {
+		g.service(srv)
+	}
+	g.helpers()
+
+	return g.source()
+}
+
+// clientsSource returns the code of the Go clients of the services
+func clientsSource(opts options, pkg *types.Package, services []*service) ([]byte, error) {
+	g := newStandaloneGenerator(opts, pkg)
+	for _, srv := range services {
+		g.serviceClient(srv)
+	}
+	g.clientHelpers()
+
+	return g.source()
+}
+
+// testsSource returns the code of the tests of the rules of the endpoints
+func testsSource(opts options, pkg *types.Package, services []*service) ([]byte, error) {
+	g := newStandaloneGenerator(opts, pkg)
+	for _, srv := range services {
+		g.serviceTests(srv)
+	}
+	g.testHelpers()
+
+	return g.source()
+}
+
+// writeOutput writes the generated file, if the code can't be formatted
+// it is written as is to look into and the error is reported after that
+func writeOutput(path string, src []byte, err error) {
+	if writeErr := os.WriteFile(path, src, 0644); writeErr != nil {
+		log.Fatal(writeErr)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func main() {
+	var opts options
+	flag.Int64Var(&opts.MaxBody, "max-body", 1<<20, "max size of JSON request body in bytes")
+	flag.StringVar(&opts.Envelope, "envelope", "default", "format of responses: "+strings.Join(envelopes, " or "))
+	flag.StringVar(&opts.RequestID, "request-id", "", "header of request ids, if set panics are replied with the id instead of the panic message")
+	lang := flag.String("lang", "go", "language of the output file: "+strings.Join(langs, " or "))
+	clientOutput := flag.String("client", "", "file to write the typed Go clients of the services to, it must be in the package of the services")
+	testsOutput := flag.String("tests", "", "file to write the tests of the rules of the endpoints to, it must be a _test.go file of the package of the services")
+	openAPIOutput := flag.String("openapi", "", "file to write the OpenAPI 3.1 document of the services to, in YAML, "+
+		"if services serve the same operations each of them is written to the file with the name of the service added")
+	openAPIService := flag.String("openapi-service", "", "service to describe in the OpenAPI document, by default all of them are")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage:", os.Args[0], "[flags] <package dir, import path or .go file> <output file>")
+		fmt.Fprintln(flag.CommandLine.Output(), "params are read from the form or from the JSON body, the latter is decoded according to json tags")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 2 || !contains(envelopes, opts.Envelope) || !contains(langs, *lang) {
+		flag.Usage()
+		os.Exit(2)
+	}
+	target, output := flag.Arg(0), flag.Arg(1)
+
+	fSet := token.NewFileSet()
+	pkg, err := loadPackage(fSet, target, output, *clientOutput, *testsOutput)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	typesPkg, services, err := analyzePackage(fSet, pkg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *lang == "ts" {
+		writeOutput(output, newTypeScript(opts, typesPkg).source(services), nil)
+	} else {
+		src, err := handlersSource(opts, typesPkg, services)
+		writeOutput(output, src, err)
+	}
+
+	if *clientOutput != "" {
+		src, err := clientsSource(opts, typesPkg, services)
+		writeOutput(*clientOutput, src, err)
+	}
+
+	if *testsOutput != "" {
+		src, err := testsSource(opts, typesPkg, services)
+		writeOutput(*testsOutput, src, err)
+	}
+
+	if *openAPIOutput != "" {
+		files, err := openAPIFiles(opts, typesPkg, services, *openAPIOutput, *openAPIService)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, file := range files {
+			writeOutput(file.Path, marshalYAML(file.Doc), nil)
+		}
+	}
 }
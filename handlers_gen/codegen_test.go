@@ -0,0 +1,683 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// testGenerated writes src and its test into a temp package, generates
+// the handlers and the tests of their rules for it and runs go vet and go test
+func testGenerated(t *testing.T, src, test string) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"api.go":      src,
+		"api_test.go": test,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fSet := token.NewFileSet()
+	pkg, err := loadPackage(fSet, filepath.Join(dir, "api.go"))
+	if err != nil {
+		t.Fatalf("load error: %v", err)
+	}
+	typesPkg, services, err := analyzePackage(fSet, pkg)
+	if err != nil {
+		t.Fatalf("analysis error: %v", err)
+	}
+
+	opts := options{MaxBody: 1 << 20, Envelope: "default"}
+	handlers, err := handlersSource(opts, typesPkg, services)
+	if err != nil {
+		t.Fatalf("handlers error: %v", err)
+	}
+	tests, err := testsSource(opts, typesPkg, services)
+	if err != nil {
+		t.Fatalf("tests error: %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "api_handlers.go"), handlers, 0644)
+	os.WriteFile(filepath.Join(dir, "api_handlers_test.go"), tests, 0644)
+
+	// the files are listed, so the package needs neither GOPATH nor go.mod
+	names := []string{"api.go", "api_handlers.go", "api_test.go", "api_handlers_test.go"}
+	for _, command := range []string{"vet", "test"} {
+		cmd := exec.Command("go", append([]string{command}, names...)...)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("go %s of the generated code failed: %v\n%s", command, err, output)
+		}
+	}
+}
+
+// CR is a JSON object of the response
+type CR map[string]interface{}
+
+// Case is a request to the generated handlers and the reply expected
+// to it, GET requests send Query in the url, others send Body
+// as JSON if it is set and Query as the form otherwise
+type Case struct {
+	Method string
+	Path   string
+	Query  string
+	Body   string
+	Status int
+	Result interface{}
+}
+
+// rulesTest sends the cases to the handlers of Api
+const rulesTest = `package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	var cases []struct {
+		Method, Path, Query, Body string
+		Status int
+		Result json.RawMessage
+	}
+	if err := json.Unmarshal([]byte(%s), &cases); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(&Api{})
+	defer ts.Close()
+
+	for _, item := range cases {
+		caseName := item.Method + " " + item.Path + "?" + item.Query + item.Body
+
+		target := ts.URL + item.Path
+		var body io.Reader
+		contentType := ""
+		switch {
+		case item.Method == http.MethodGet:
+			target += "?" + item.Query
+		case item.Body != "":
+			body = strings.NewReader(item.Body)
+			contentType = "application/json"
+		default:
+			body = strings.NewReader(item.Query)
+			contentType = "application/x-www-form-urlencoded"
+		}
+		req, _ := http.NewRequest(item.Method, target, body)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("[%%s] request error: %%v", caseName, err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != item.Status {
+			t.Errorf("[%%s] expected http status %%v, got %%v: %%s", caseName, item.Status, resp.StatusCode, data)
+			continue
+		}
+		var result, expected interface{}
+		json.Unmarshal(data, &result)
+		json.Unmarshal(item.Result, &expected)
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("[%%s] results not match\nGot: %%s\nExpected: %%s", caseName, data, item.Result)
+		}
+	}
+}
+`
+
+// testRules generates the handlers of src, which has to declare the service Api,
+// and sends the cases to them. Requests are sent with GET to /check by default
+func testRules(t *testing.T, src string, cases []Case) {
+	for i := range cases {
+		if cases[i].Method == "" {
+			cases[i].Method = "GET"
+		}
+		if cases[i].Path == "" {
+			cases[i].Path = "/check"
+		}
+	}
+	data, err := json.Marshal(cases)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testGenerated(t, src, fmt.Sprintf(rulesTest, strconv.Quote(string(data))))
+}
+
+func TestSliceRules(t *testing.T) {
+	testRules(t, `package api
+
+import (
+	"context"
+	"fmt"
+)
+
+type Params struct {
+	Tags []string "apivalidator:\"min=2,minItems=1,maxItems=2,unique\""
+	IDs  []int    "apivalidator:\"paramname=ids,csv,max=10\""
+}
+
+type Api struct{}
+
+// apigen:api {"url": "/check", "auth": false}
+func (srv *Api) Check(ctx context.Context, in Params) (string, error) {
+	return fmt.Sprint(in.Tags, in.IDs), nil
+}
+`, []Case{
+		{ // repeated and comma-separated values
+			Query:  "tags=ab&tags=cd&ids=1,2&ids=3",
+			Status: 200,
+			Result: CR{"error": "", "response": "[ab cd] [1 2 3]"},
+		},
+		{
+			Query:  "ids=1",
+			Status: 400,
+			Result: CR{"error": "tags must contain >= 1 items"},
+		},
+		{ // min and max are checked for every item
+			Query:  "tags=a",
+			Status: 400,
+			Result: CR{"error": "tags len must be >= 2"},
+		},
+		{
+			Query:  "tags=ab&tags=cd&tags=ef",
+			Status: 400,
+			Result: CR{"error": "tags must contain <= 2 items"},
+		},
+		{
+			Query:  "tags=ab&tags=ab",
+			Status: 400,
+			Result: CR{"error": "tags must contain unique items"},
+		},
+		{
+			Query:  "tags=ab&ids=1,x",
+			Status: 400,
+			Result: CR{"error": "ids must be int"},
+		},
+		{
+			Query:  "tags=ab&ids=1,11",
+			Status: 400,
+			Result: CR{"error": "ids must be <= 10"},
+		},
+	})
+}
+
+func TestJSONTagParams(t *testing.T) {
+	testRules(t, `package api
+
+import (
+	"context"
+	"strconv"
+)
+
+type Params struct {
+	SizeBytes int    "json:\"size_bytes\" apivalidator:\"min=1\""
+	Name      string "json:\"-\""
+}
+
+type Api struct{}
+
+// apigen:api {"url": "/check", "auth": false}
+func (srv *Api) Check(ctx context.Context, in Params) (string, error) {
+	return strconv.Itoa(in.SizeBytes) + " " + in.Name, nil
+}
+`, []Case{
+		{ // the form param is named like the JSON key
+			Query:  "size_bytes=5&name=a",
+			Status: 200,
+			Result: CR{"error": "", "response": "5 a"},
+		},
+		{
+			Method: "POST",
+			Body:   `{"size_bytes": 5}`,
+			Status: 200,
+			Result: CR{"error": "", "response": "5 "},
+		},
+		{
+			Query:  "size_bytes=0&size=5",
+			Status: 400,
+			Result: CR{"error": "size_bytes must be >= 1"},
+		},
+	})
+}
+
+func TestPathParams(t *testing.T) {
+	testRules(t, `package api
+
+import (
+	"context"
+	"strconv"
+)
+
+type PathParams struct {
+	ID   int    "apivalidator:\"source=path,min=1\""
+	Name string "apivalidator:\"source=path\""
+}
+
+type Api struct{}
+
+// apigen:api {"url": "/item/{id:int}/{name}", "auth": false, "method": "GET"}
+func (srv *Api) Item(ctx context.Context, in PathParams) (string, error) {
+	return strconv.Itoa(in.ID) + " " + in.Name, nil
+}
+`, []Case{
+		{
+			Path:   "/item/12/abc",
+			Status: 200,
+			Result: CR{"error": "", "response": "12 abc"},
+		},
+		{ // escaped slashes are kept in placeholders
+			Path:   "/item/12/a%20b%2Fc",
+			Status: 200,
+			Result: CR{"error": "", "response": "12 a b/c"},
+		},
+		{
+			Path:   "/item/0/abc",
+			Status: 400,
+			Result: CR{"error": "id must be >= 1"},
+		},
+		{
+			Path:   "/item/ab/abc",
+			Status: 404,
+			Result: CR{"error": "unknown method"},
+		},
+	})
+}
+
+func TestServeHTTPBuildsRouterOnce(t *testing.T) {
+	testGenerated(t, `package api
+
+import (
+	"context"
+	"net/http"
+)
+
+type Api struct {
+	built int
+}
+
+// apigen:api {"url": "/ping", "auth": false, "middleware": ["Count"]}
+func (srv *Api) Ping(ctx context.Context, in struct{}) (string, error) {
+	return "pong", nil
+}
+
+// Count counts how many times the handler of Ping is built
+func (srv *Api) Count(next http.Handler) http.Handler {
+	srv.built++
+	return next
+}
+`, `package api
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPing(t *testing.T) {
+	srv := &Api{}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	for i := 0; i < 3; i++ {
+		resp, err := ts.Client().Get(ts.URL + "/ping")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if srv.built != 1 {
+		t.Errorf("expected the router to be built once, got %d times", srv.built)
+	}
+}
+`)
+}
+
+func TestStringRules(t *testing.T) {
+	testRules(t, `package api
+
+import (
+	"context"
+	"strings"
+)
+
+type Params struct {
+	Login string "apivalidator:\"trim,lowercase,pattern='^[a-z]+$',min=3\""
+	Name  string "apivalidator:\"trim,max=5\""
+	Email string "apivalidator:\"format=email\""
+	ID    string "apivalidator:\"format=uuid\""
+	Site  string "apivalidator:\"format=url\""
+	IP    string "apivalidator:\"format=ipv4\""
+	Born  string "apivalidator:\"format=date-time\""
+}
+
+type Api struct{}
+
+// apigen:api {"url": "/check", "auth": false}
+func (srv *Api) Check(ctx context.Context, in Params) (string, error) {
+	return strings.Join([]string{in.Login, in.Name}, " "), nil
+}
+`, []Case{
+		{ // normalizers are applied before the checks
+			Query:  "login=+BoB+&name=+alice+&email=bob@example.com&id=123e4567-e89b-12d3-a456-426614174000&site=https://example.com&ip=10.0.0.1&born=2006-01-02T15:04:05Z",
+			Status: 200,
+			Result: CR{"error": "", "response": "bob alice"},
+		},
+		{ // the quoted pattern is followed by other rules
+			Query:  "login=b0b",
+			Status: 400,
+			Result: CR{"error": "login must match ^[a-z]+$"},
+		},
+		{
+			Query:  "login=ab",
+			Status: 400,
+			Result: CR{"error": "login len must be >= 3"},
+		},
+		{
+			Query:  "login=bob&name=carol6",
+			Status: 400,
+			Result: CR{"error": "name len must be <= 5"},
+		},
+		{
+			Query:  "login=bob&email=bob",
+			Status: 400,
+			Result: CR{"error": "email must be a valid email"},
+		},
+		{
+			Query:  "login=bob&id=123",
+			Status: 400,
+			Result: CR{"error": "id must be a valid uuid"},
+		},
+		{
+			Query:  "login=bob&site=example.com",
+			Status: 400,
+			Result: CR{"error": "site must be a valid url"},
+		},
+		{
+			Query:  "login=bob&ip=10.0.0",
+			Status: 400,
+			Result: CR{"error": "ip must be a valid ipv4"},
+		},
+		{
+			Query:  "login=bob&born=yesterday",
+			Status: 400,
+			Result: CR{"error": "born must be a valid date-time"},
+		},
+	})
+}
+
+func TestValidatorRules(t *testing.T) {
+	testRules(t, `package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+type Params struct {
+	Name  string "apivalidator:\"validate=checkName\""
+	Count int    "apivalidator:\"validate=checkEven\""
+}
+
+// Validate is called after the fields are checked
+func (in Params) Validate() error {
+	if in.Name == "" && in.Count != 0 {
+		return errors.New("count requires name")
+	}
+	return nil
+}
+
+type Api struct{}
+
+func (srv *Api) checkName(ctx context.Context, name string) error {
+	if name == "admin" {
+		return fmt.Errorf("name %s is taken", name)
+	}
+	return nil
+}
+
+func checkEven(ctx context.Context, count int) error {
+	if count%2 != 0 {
+		return errors.New("must be even")
+	}
+	return nil
+}
+
+// apigen:api {"url": "/check", "auth": false}
+func (srv *Api) Check(ctx context.Context, in Params) (string, error) {
+	return fmt.Sprint(in.Name, in.Count), nil
+}
+`, []Case{
+		{
+			Query:  "name=bob&count=2",
+			Status: 200,
+			Result: CR{"error": "", "response": "bob2"},
+		},
+		{ // method of the service
+			Query:  "name=admin",
+			Status: 400,
+			Result: CR{"error": "name admin is taken"},
+		},
+		{ // package func
+			Query:  "name=bob&count=3",
+			Status: 400,
+			Result: CR{"error": "must be even"},
+		},
+		{ // Validate of the params
+			Query:  "count=2",
+			Status: 400,
+			Result: CR{"error": "count requires name"},
+		},
+	})
+}
+
+func TestCrossFieldRules(t *testing.T) {
+	testRules(t, `package api
+
+import (
+	"context"
+	"fmt"
+)
+
+type Params struct {
+	Kind     string "apivalidator:\"enum=person|company,default=person\""
+	Company  string "apivalidator:\"required_if=Kind:company\""
+	Email    string "apivalidator:\"\""
+	Phone    string "apivalidator:\"required_without=Email\""
+	Password string "apivalidator:\"\""
+	Confirm  string "apivalidator:\"eqfield=Password\""
+	From     int    "apivalidator:\"\""
+	To       int    "apivalidator:\"gtfield=From\""
+}
+
+type Api struct{}
+
+// apigen:api {"url": "/check", "auth": false}
+func (srv *Api) Check(ctx context.Context, in Params) (string, error) {
+	return fmt.Sprint(in.Kind, in.Company), nil
+}
+`, []Case{
+		{
+			Query:  "kind=company&company=acme&email=a@b.c&password=x&confirm=x&from=1&to=2",
+			Status: 200,
+			Result: CR{"error": "", "response": "companyacme"},
+		},
+		{
+			Query:  "kind=company&email=a@b.c",
+			Status: 400,
+			Result: CR{"error": "company is required when kind is company"},
+		},
+		{
+			Query:  "kind=person",
+			Status: 400,
+			Result: CR{"error": "phone is required when email is not set"},
+		},
+		{
+			Query:  "phone=1&password=x&confirm=y",
+			Status: 400,
+			Result: CR{"error": "confirm must be equal to password"},
+		},
+		{
+			Query:  "phone=1&from=2&to=2",
+			Status: 400,
+			Result: CR{"error": "to must be greater than from"},
+		},
+	})
+}
+
+func TestDurationParams(t *testing.T) {
+	testRules(t, `package api
+
+import (
+	"context"
+	"time"
+)
+
+type WaitParams struct {
+	Wait time.Duration "apivalidator:\"default=1m30s,min=1000000000\""
+}
+
+type Api struct{}
+
+// apigen:api {"url": "/check", "auth": false, "method": "GET"}
+func (srv *Api) Wait(ctx context.Context, in WaitParams) (string, error) {
+	return in.Wait.String(), nil
+}
+`, []Case{
+		{
+			Status: 200,
+			Result: CR{"error": "", "response": "1m30s"},
+		},
+		{
+			Query:  "wait=2m",
+			Status: 200,
+			Result: CR{"error": "", "response": "2m0s"},
+		},
+		{
+			Query:  "wait=90",
+			Status: 400,
+			Result: CR{"error": "wait must be a duration"},
+		},
+		{
+			Query:  "wait=10ms",
+			Status: 400,
+			Result: CR{"error": "wait must be >= 1000000000"},
+		},
+	})
+}
+
+func TestBoolDefault(t *testing.T) {
+	testRules(t, `package api
+
+import (
+	"context"
+	"strconv"
+)
+
+type Params struct {
+	Active bool "json:\"active\" apivalidator:\"default=true\""
+}
+
+type Api struct{}
+
+// apigen:api {"url": "/check", "auth": false}
+func (srv *Api) Check(ctx context.Context, in Params) (string, error) {
+	return strconv.FormatBool(in.Active), nil
+}
+`, []Case{
+		{
+			Status: 200,
+			Result: CR{"error": "", "response": "true"},
+		},
+		{
+			Query:  "active=false",
+			Status: 200,
+			Result: CR{"error": "", "response": "false"},
+		},
+		{ // JSON bodies can't tell an absent bool from false
+			Method: "POST",
+			Body:   `{}`,
+			Status: 200,
+			Result: CR{"error": "", "response": "false"},
+		},
+		{
+			Method: "POST",
+			Body:   `{"active": true}`,
+			Status: 200,
+			Result: CR{"error": "", "response": "true"},
+		},
+	})
+}
+
+func TestEnumRules(t *testing.T) {
+	testRules(t, `package api
+
+import (
+	"context"
+	"fmt"
+)
+
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleAdmin Role = "admin"
+)
+
+type Level int
+
+const (
+	LevelLow Level = iota + 1
+	LevelHigh
+)
+
+type Limit int
+
+const DefaultLimit Limit = 20
+
+type Params struct {
+	Role   Role    "apivalidator:\"default=user\""
+	Levels []Level "apivalidator:\"\""
+	Limit  Limit   "apivalidator:\"\""
+}
+
+type Api struct{}
+
+// apigen:api {"url": "/check", "auth": false}
+func (srv *Api) Check(ctx context.Context, in Params) (string, error) {
+	return fmt.Sprint(in.Role, in.Levels, in.Limit), nil
+}
+`, []Case{
+		{ // a single constant isn't an enum
+			Query:  "levels=2&limit=5",
+			Status: 200,
+			Result: CR{"error": "", "response": "user[2] 5"},
+		},
+		{
+			Query:  "role=root",
+			Status: 400,
+			Result: CR{"error": "role must be one of [user, admin]"},
+		},
+		{
+			Query:  "levels=1&levels=3",
+			Status: 400,
+			Result: CR{"error": "levels must be one of [1, 2]"},
+		},
+	})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"go/types"
+	"reflect"
+	"strings"
+)
+
+// jsonField is a field of a struct as encoding/json writes it
+type jsonField struct {
+	// Key is the name of the field in the JSON object
+	Key string
+	Var *types.Var
+	// Path is the Go name of the field prefixed with the names
+	// of the embedded structs it is promoted from
+	Path      string
+	OmitEmpty bool
+	// String is set by the string option writing the value as a JSON string
+	String bool
+}
+
+// jsonFields returns the fields of the struct as encoding/json writes them,
+// fields of embedded structs without a json name are written as if they
+// were declared in st and get path with the name of the embedded field
+func jsonFields(st *types.Struct, path string) []jsonField {
+	var fields []jsonField
+	for i := 0; i < st.NumFields(); i++ {
+		v := st.Field(i)
+		// the name of json:"-," is -
+		name, tagOpts, hasOpts := strings.Cut(reflect.StructTag(st.Tag(i)).Get("json"), ",")
+		if name == "-" && !hasOpts {
+			continue
+		}
+		opts := strings.Split(tagOpts, ",")
+
+		if v.Embedded() && name == "" {
+			t := types.Unalias(v.Type())
+			if ptr, ok := t.(*types.Pointer); ok {
+				t = ptr.Elem()
+			}
+			if embedded, ok := t.Underlying().(*types.Struct); ok {
+				fields = append(fields, jsonFields(embedded, path+v.Name()+".")...)
+				continue
+			}
+		}
+		if !v.Exported() {
+			continue
+		}
+		if name == "" {
+			name = v.Name()
+		}
+
+		fields = append(fields, jsonField{
+			Key:       name,
+			Var:       v,
+			Path:      path + v.Name(),
+			OmitEmpty: contains(opts, "omitempty"),
+			String:    contains(opts, "string"),
+		})
+	}
+
+	return fields
+}
+
+// how encoding/json writes the values of named types
+const (
+	jsonDefault = iota
+	// jsonTime is the RFC 3339 string of time.Time
+	jsonTime
+	// jsonMarshaler is any JSON written by MarshalJSON
+	jsonMarshaler
+	// jsonText is the string written by MarshalText
+	jsonText
+)
+
+// jsonEncoding returns how encoding/json writes the values of the named type
+func jsonEncoding(t *types.Named) int {
+	obj := t.Obj()
+	if obj.Pkg() != nil && obj.Pkg().Path() == "time" && obj.Name() == "Time" {
+		return jsonTime
+	}
+
+	ptr := types.NewPointer(t)
+	if method, _, _ := types.LookupFieldOrMethod(ptr, false, obj.Pkg(), "MarshalJSON"); method != nil {
+		return jsonMarshaler
+	}
+	if method, _, _ := types.LookupFieldOrMethod(ptr, false, obj.Pkg(), "MarshalText"); method != nil {
+		return jsonText
+	}
+
+	return jsonDefault
+}
+
+// structNames are the names of named structs described once
+// and referred to by the name everywhere else
+type structNames map[*types.TypeName]string
+
+// name returns the name of the struct, the first time it is taken with take
+// and the struct is described with describe. The name is taken before
+// the fields are described as they may refer to the struct itself
+func (names structNames) name(t *types.Named, take func() string, describe func(name string)) string {
+	if name, ok := names[t.Obj()]; ok {
+		return name
+	}
+
+	name := take()
+	names[t.Obj()] = name
+	describe(name)
+
+	return name
+}
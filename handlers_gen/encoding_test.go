@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"go/types"
+	"reflect"
+	"testing"
+)
+
+func TestJSONFields(t *testing.T) {
+	str := types.Typ[types.String]
+	newVar := func(name string, typ types.Type, embedded bool) *types.Var {
+		return types.NewField(0, nil, name, typ, embedded)
+	}
+	base := types.NewStruct([]*types.Var{
+		newVar("ID", str, false),
+		newVar("Token", str, false),
+	}, []string{`json:"id"`, `json:"-"`})
+	baseType := types.NewNamed(types.NewTypeName(0, nil, "Base", nil), base, nil)
+	st := types.NewStruct([]*types.Var{
+		newVar("Base", types.NewPointer(baseType), true),
+		newVar("Name", str, false),
+		newVar("Count", types.Typ[types.Int], false),
+		newVar("Dash", str, false),
+		newVar("hidden", str, false),
+	}, []string{``, `json:"name,omitempty"`, `json:",string"`, `json:"-,"`, ``})
+
+	var got []string
+	for _, jf := range jsonFields(st, "") {
+		got = append(got, fmt.Sprintf("%s %s %v %v", jf.Key, jf.Path, jf.OmitEmpty, jf.String))
+	}
+	expected := []string{
+		"id Base.ID false false",
+		"name Name true false",
+		"Count Count false true",
+		"- Dash false false",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("fields not match\nGot: %q\nExpected: %q", got, expected)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"go/token"
+	"go/types"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the generated output")
+
+type goldenFile struct {
+	Name string
+	Src  []byte
+}
+
+// analyzeFiles analyzes the package of target, the generated files
+// of the package are skipped as the generator does
+func analyzeFiles(t *testing.T, target string, skip ...string) (*types.Package, []*service) {
+	fSet := token.NewFileSet()
+	pkg, err := loadPackage(fSet, target, skip...)
+	if err != nil {
+		t.Fatalf("load error: %v", err)
+	}
+	typesPkg, services, err := analyzePackage(fSet, pkg)
+	if err != nil {
+		t.Fatalf("analysis error: %v", err)
+	}
+
+	return typesPkg, services
+}
+
+// generateFiles generates every kind of output for the services
+func generateFiles(t *testing.T, opts options, typesPkg *types.Package, services []*service) []goldenFile {
+	var files []goldenFile
+	add := func(name string, src []byte, err error) {
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		files = append(files, goldenFile{name, src})
+	}
+
+	src, err := handlersSource(opts, typesPkg, services)
+	add("api_handlers.go", src, err)
+	src, err = clientsSource(opts, typesPkg, services)
+	add("api_client.go", src, err)
+	src, err = testsSource(opts, typesPkg, services)
+	add("api_handlers_test.go", src, err)
+	add("api.ts", newTypeScript(opts, typesPkg).source(services), nil)
+	docs, err := openAPIFiles(opts, typesPkg, services, "api_openapi.yaml", "")
+	if err != nil {
+		t.Fatalf("api_openapi.yaml: %v", err)
+	}
+	for _, doc := range docs {
+		add(doc.Path, marshalYAML(doc.Doc), nil)
+	}
+
+	return files
+}
+
+// generateGolden generates every kind of output for api.go of the repo,
+// MyApi and OtherApi both serve POST /user/create, so they are described apart
+func generateGolden(t *testing.T) []goldenFile {
+	typesPkg, services := analyzeFiles(t, "../api.go", "../api_handlers.go")
+
+	opts := options{MaxBody: 1 << 20, Envelope: "default"}
+	files := generateFiles(t, opts, typesPkg, services)
+
+	problem := opts
+	problem.Envelope = "problem"
+	src, err := handlersSource(problem, typesPkg, services)
+	if err != nil {
+		t.Fatalf("api_handlers_problem.go: %v", err)
+	}
+
+	return append(files, goldenFile{"api_handlers_problem.go", src})
+}
+
+func TestGolden(t *testing.T) {
+	files := generateGolden(t)
+
+	// nothing may depend on the order maps are iterated in
+	for i, again := range generateGolden(t) {
+		if !bytes.Equal(files[i].Src, again.Src) {
+			line, got, expected := firstDiff(again.Src, files[i].Src)
+			t.Errorf("[%s] output differs between runs at line %d\nGot: %s\nExpected: %s", again.Name, line, got, expected)
+		}
+	}
+
+	for _, file := range files {
+		golden := filepath.Join("testdata", file.Name+".golden")
+		if *update {
+			if err := os.WriteFile(golden, file.Src, 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		expected, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatalf("[%s] %v, run go test -update to write it", file.Name, err)
+		}
+		if !bytes.Equal(file.Src, expected) {
+			line, got, want := firstDiff(file.Src, expected)
+			t.Errorf("[%s] output doesn't match %s at line %d, run go test -update if the change is intended\nGot: %s\nExpected: %s", file.Name, golden, line, got, want)
+		}
+	}
+
+	// the generated files of the repo are regenerated along with the generator
+	for _, file := range files {
+		committed, err := os.ReadFile(filepath.Join("..", file.Name))
+		if err != nil {
+			continue
+		}
+		if !bytes.Equal(file.Src, committed) {
+			t.Errorf("[%s] the file is stale, regenerate it with the generator", file.Name)
+		}
+	}
+}
+
+// TestFixture generates the code of a package using every rule next to it,
+// the package's own tests then send requests to the generated handlers
+func TestFixture(t *testing.T) {
+	dir := filepath.Join("testdata", "fixture")
+	typesPkg, services := analyzeFiles(t, filepath.Join(dir, "api.go"),
+		filepath.Join(dir, "api_handlers.go"), filepath.Join(dir, "api_client.go"))
+	files := generateFiles(t, options{MaxBody: 1 << 20, Envelope: "default"}, typesPkg, services)
+
+	names := []string{"api.go", "api_test.go"}
+	for _, file := range files {
+		fileName := filepath.Join(dir, file.Name)
+		if strings.HasSuffix(file.Name, ".go") {
+			names = append(names, file.Name)
+		}
+		if *update {
+			if err := os.WriteFile(fileName, file.Src, 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		expected, err := os.ReadFile(fileName)
+		if err != nil {
+			t.Fatalf("[%s] %v, run go test -update to write it", file.Name, err)
+		}
+		if !bytes.Equal(file.Src, expected) {
+			line, got, want := firstDiff(file.Src, expected)
+			t.Errorf("[%s] output doesn't match %s at line %d, run go test -update if the change is intended\nGot: %s\nExpected: %s", file.Name, fileName, line, got, want)
+		}
+	}
+	if t.Failed() {
+		return
+	}
+
+	// the files are listed, so the package needs neither GOPATH nor go.mod
+	for _, command := range []string{"vet", "test"} {
+		cmd := exec.Command("go", append([]string{command}, names...)...)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("go %s of the fixture failed: %v\n%s", command, err, output)
+		}
+	}
+}
+
+// firstDiff returns the number of the first line which differs and its versions
+func firstDiff(got, expected []byte) (int, string, string) {
+	gotLines := strings.Split(string(got), "\n")
+	expectedLines := strings.Split(string(expected), "\n")
+	for i := 0; ; i++ {
+		var g, e string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(expectedLines) {
+			e = expectedLines[i]
+		}
+		if g != e || i >= len(gotLines) && i >= len(expectedLines) {
+			return i + 1, g, e
+		}
+	}
+}
@@ -0,0 +1,725 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// openAPI builds the OpenAPI 3.1 document of the services,
+// it describes the requests and responses the generated handlers work with
+type openAPI struct {
+	opts options
+	pkg  *types.Package
+	// schemas are the components of named structs and of errors
+	schemas yamlMap
+	names   structNames
+	// security are the schemes of the auth strategies in use
+	security yamlMap
+}
+
+func newOpenAPI(opts options, pkg *types.Package) *openAPI {
+	return &openAPI{
+		opts:  opts,
+		pkg:   pkg,
+		names: make(structNames),
+	}
+}
+
+// openAPIFormats are the formats of the format rules in OpenAPI
+var openAPIFormats = map[string]string{
+	"email":     "email",
+	"uuid":      "uuid",
+	"url":       "uri",
+	"ipv4":      "ipv4",
+	"date-time": "date-time",
+}
+
+// openAPIFile is a document with the path of the file it is written to
+type openAPIFile struct {
+	Path string
+	Doc  yamlMap
+}
+
+// openAPIFiles returns the documents of the services written to output.
+// All of them are described in a single document unless operations of
+// different services have the same method and path, then every service
+// is described in a document of its own with the name of the service
+// added to the name of output, e.g. api_MyApi.yaml.
+func openAPIFiles(opts options, pkg *types.Package, services []*service, output, name string) ([]openAPIFile, error) {
+	if name != "" || !operationsCollide(services) {
+		doc, err := newOpenAPI(opts, pkg).document(services, name)
+		if err != nil {
+			return nil, err
+		}
+		return []openAPIFile{{output, doc}}, nil
+	}
+
+	ext := filepath.Ext(output)
+	var files []openAPIFile
+	for _, srv := range services {
+		doc, err := newOpenAPI(opts, pkg).document(services, srv.Name)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, openAPIFile{strings.TrimSuffix(output, ext) + "_" + srv.Name + ext, doc})
+	}
+
+	return files, nil
+}
+
+// operationsCollide reports whether operations of different services
+// have the same method and path
+func operationsCollide(services []*service) bool {
+	owners := make(map[string]*service)
+	for _, srv := range services {
+		for _, ep := range srv.Endpoints {
+			path, methods := operations(ep)
+			for _, method := range methods {
+				if owner, taken := owners[method+" "+path]; taken && owner != srv {
+					return true
+				}
+				owners[method+" "+path] = srv
+			}
+		}
+	}
+
+	return false
+}
+
+// operations returns the path of the operations describing the endpoint
+// and their methods, endpoints accepting any method are described with
+// get and post, the methods params are sent with in the query and in the body
+func operations(ep *endpoint) (string, []string) {
+	path := ep.Spec.URL
+	if ep.Route != nil {
+		path = ep.Route.Path
+	}
+	methods := ep.Spec.Methods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodPost}
+	}
+
+	return path, methods
+}
+
+// document returns the document of the services or of the service with the name.
+// Operations can't have the same method and path as they would be the same
+// operation of the document, see openAPIFiles.
+func (o *openAPI) document(services []*service, name string) (yamlMap, error) {
+	if name != "" {
+		var found []*service
+		for _, srv := range services {
+			if srv.Name == name {
+				found = append(found, srv)
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("service %s has no endpoints", name)
+		}
+		services = found
+	}
+	o.errorSchemas(services)
+
+	paths := yamlMap{}
+	owners := make(map[string]string)
+	for _, srv := range services {
+		for _, ep := range srv.Endpoints {
+			path, methods := operations(ep)
+			item, _ := paths.get(path).(yamlMap)
+			for _, method := range methods {
+				owner := srv.Name + "." + ep.Name
+				if other, taken := owners[method+" "+path]; taken {
+					return nil, fmt.Errorf("%s %s is served by both %s and %s", method, path, other, owner)
+				}
+				owners[method+" "+path] = owner
+
+				item.set(strings.ToLower(method), o.operation(srv, ep, method, len(methods) > 1))
+			}
+			paths.set(path, item)
+		}
+	}
+
+	sort.SliceStable(o.schemas, func(i, j int) bool {
+		return o.schemas[i].Key < o.schemas[j].Key
+	})
+	components := yamlMap{{"schemas", o.schemas}}
+	if len(o.security) != 0 {
+		components = append(components, yamlItem{"securitySchemes", o.security})
+	}
+
+	return yamlMap{
+		{"openapi", "3.1.0"},
+		{"info", yamlMap{
+			{"title", o.pkg.Name()},
+			{"version", "1.0.0"},
+		}},
+		{"paths", paths},
+		{"components", components},
+	}, nil
+}
+
+// operation describes the endpoint called with the method,
+// several is set if the endpoint accepts more than one method
+func (o *openAPI) operation(srv *service, ep *endpoint, method string, several bool) yamlMap {
+	id := srv.Name + ep.Name
+	if several {
+		id += method[:1] + strings.ToLower(method[1:])
+	}
+	op := yamlMap{
+		{"operationId", id},
+		{"tags", []interface{}{srv.Name}},
+	}
+	if doc := docText(ep.Decl.Doc); doc != "" {
+		op.set("description", doc)
+	}
+
+	var params []interface{}
+	if ep.Route != nil {
+		for _, rp := range ep.Route.Params {
+			schema := yamlMap{{"type", "string"}}
+			for _, f := range ep.Params.Fields {
+				if f.Rules.Source == "path" && f.Param == rp.Name {
+					schema = o.fieldSchema(f, true)
+				}
+			}
+			params = append(params, yamlMap{
+				{"name", rp.Name},
+				{"in", "path"},
+				{"required", true},
+				{"schema", schema},
+			})
+		}
+	}
+
+	formFields := flattenFields(ep.Params.Fields, false)
+	hasBody := method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch
+	if !hasBody {
+		for _, f := range formFields {
+			param := yamlMap{
+				{"name", f.field.Param},
+				{"in", "query"},
+			}
+			if f.required {
+				param.set("required", true)
+			}
+			param.set("schema", o.fieldSchema(f.field, true))
+			if f.field.Slice && f.field.Rules.CSV {
+				param.set("explode", false)
+			}
+			params = append(params, param)
+		}
+	}
+	if len(params) != 0 {
+		op.set("parameters", params)
+	}
+	if hasBody && len(formFields) != 0 {
+		op.set("requestBody", o.requestBody(ep, formFields))
+	}
+
+	if auth := ep.Spec.Auth; auth != nil {
+		if scheme := o.securityScheme(auth); scheme != "" {
+			scopes := []interface{}{}
+			for _, scope := range ep.Spec.Scopes {
+				scopes = append(scopes, scope)
+			}
+			op.set("security", []interface{}{yamlMap{{scheme, scopes}}})
+		}
+	}
+
+	op.set("responses", o.responses(ep))
+
+	return op
+}
+
+// formField is a field filled from a form param,
+// required is set if it must be sent along with the struct it is nested in
+type formField struct {
+	field    *field
+	required bool
+}
+
+// flattenFields returns the fields filled from form params
+// with the fields of nested structs in their place
+func flattenFields(fields []*field, optional bool) []formField {
+	var flat []formField
+	for _, f := range fields {
+		switch {
+		case f.Rules.Source == "path":
+		case f.Fields != nil:
+			flat = append(flat, flattenFields(f.Fields, optional || f.Ptr && !f.Rules.Required)...)
+		default:
+			flat = append(flat, formField{
+				field:    f,
+				required: !optional && f.Rules.Required && f.Default == nil,
+			})
+		}
+	}
+
+	return flat
+}
+
+// requestBody describes the form and the JSON body, the latter
+// is decoded into the params struct according to json tags
+func (o *openAPI) requestBody(ep *endpoint, formFields []formField) yamlMap {
+	properties := yamlMap{}
+	var required []interface{}
+	for _, f := range formFields {
+		properties.set(f.field.Param, o.fieldSchema(f.field, true))
+		if f.required {
+			required = append(required, f.field.Param)
+		}
+	}
+	form := yamlMap{
+		{"type", "object"},
+		{"properties", properties},
+	}
+	if required != nil {
+		form.set("required", required)
+	}
+
+	fields := make(map[string]*field)
+	var index func([]*field)
+	index = func(list []*field) {
+		for _, f := range list {
+			fields[f.Name] = f
+			index(f.Fields)
+		}
+	}
+	index(ep.Params.Fields)
+
+	st := ep.Params.Type.Underlying().(*types.Struct)
+
+	return yamlMap{
+		{"required", true},
+		{"content", yamlMap{
+			{"application/x-www-form-urlencoded", yamlMap{{"schema", form}}},
+			{"application/json", yamlMap{{"schema", o.objectSchema(st, "", fields)}}},
+		}},
+	}
+}
+
+// responses describes the result of the endpoint and its errors
+func (o *openAPI) responses(ep *endpoint) yamlMap {
+	result := o.schema(ep.Result)
+	if o.opts.Envelope == "default" {
+		result = yamlMap{
+			{"type", "object"},
+			{"properties", yamlMap{
+				{"error", yamlMap{{"type", "string"}}},
+				{"response", result},
+			}},
+			{"required", []interface{}{"error", "response"}},
+		}
+	}
+
+	badRequest := o.errorName()
+	if ep.Spec.Errors == "all" && len(ep.Params.Fields) != 0 {
+		badRequest = "ValidationError"
+	}
+
+	responses := yamlMap{
+		{"200", yamlMap{
+			{"description", "OK"},
+			{"content", yamlMap{{"application/json", yamlMap{{"schema", result}}}}},
+		}},
+		{"400", o.errorResponse("the request is malformed or its params are not valid", badRequest)},
+	}
+	if ep.Spec.Auth != nil {
+		responses.set("401", o.errorResponse("the request is not authenticated", o.errorName()))
+		if ep.Spec.Roles != nil || ep.Spec.Scopes != nil {
+			responses.set("403", o.errorResponse("the principal lacks roles or scopes", o.errorName()))
+		}
+	}
+	responses.set("default", o.errorResponse("the method failed", o.errorName()))
+
+	return responses
+}
+
+func (o *openAPI) errorResponse(description, schema string) yamlMap {
+	contentType := "application/json"
+	if o.opts.Envelope == "problem" {
+		contentType = "application/problem+json"
+	}
+
+	return yamlMap{
+		{"description", description},
+		{"content", yamlMap{{contentType, yamlMap{{"schema", schemaRef(schema)}}}}},
+	}
+}
+
+// errorName is the name of the error schema in the envelope
+func (o *openAPI) errorName() string {
+	if o.opts.Envelope == "problem" {
+		return "Problem"
+	}
+
+	return "Error"
+}
+
+// errorSchemas adds the schemas of errors before the schemas of types,
+// so the types are renamed if their names are taken
+func (o *openAPI) errorSchemas(services []*service) {
+	str := yamlMap{{"type", "string"}}
+
+	if o.opts.Envelope == "problem" {
+		o.schemas.set("Problem", yamlMap{
+			{"type", "object"},
+			{"properties", yamlMap{
+				{"type", str},
+				{"title", str},
+				{"status", yamlMap{{"type", "integer"}}},
+				{"detail", str},
+			}},
+			{"required", []interface{}{"type", "title", "status"}},
+		})
+	} else {
+		o.schemas.set("Error", yamlMap{
+			{"type", "object"},
+			{"properties", yamlMap{{"error", str}}},
+			{"required", []interface{}{"error"}},
+		})
+	}
+
+	for _, srv := range services {
+		for _, ep := range srv.Endpoints {
+			if ep.Spec.Errors != "all" || len(ep.Params.Fields) == 0 {
+				continue
+			}
+
+			o.schemas.set("FieldError", yamlMap{
+				{"type", "object"},
+				{"properties", yamlMap{
+					{"field", str},
+					{"rule", str},
+					{"message", str},
+				}},
+				{"required", []interface{}{"field", "rule", "message"}},
+			})
+			errorsSchema := yamlMap{
+				{"type", "array"},
+				{"items", schemaRef("FieldError")},
+			}
+			if o.opts.Envelope == "problem" {
+				o.schemas.set("ValidationError", yamlMap{
+					{"allOf", []interface{}{
+						schemaRef("Problem"),
+						yamlMap{
+							{"type", "object"},
+							{"properties", yamlMap{{"errors", errorsSchema}}},
+							{"required", []interface{}{"errors"}},
+						},
+					}},
+				})
+			} else {
+				o.schemas.set("ValidationError", yamlMap{
+					{"type", "object"},
+					{"properties", yamlMap{
+						{"error", str},
+						{"errors", errorsSchema},
+					}},
+					{"required", []interface{}{"error", "errors"}},
+				})
+			}
+			return
+		}
+	}
+}
+
+// securityScheme adds the scheme of the auth strategy and returns its name,
+// method auth is up to the service so it has no scheme
+func (o *openAPI) securityScheme(auth *authSpec) string {
+	var scheme yamlMap
+	switch auth.Type {
+	case "token":
+		scheme = yamlMap{{"type", "apiKey"}, {"in", "header"}, {"name", auth.Header}}
+	case "apikey":
+		if auth.Query != "" {
+			scheme = yamlMap{{"type", "apiKey"}, {"in", "query"}, {"name", auth.Query}}
+		} else {
+			scheme = yamlMap{{"type", "apiKey"}, {"in", "header"}, {"name", auth.Header}}
+		}
+	case "bearer":
+		scheme = yamlMap{{"type", "http"}, {"scheme", "bearer"}}
+	case "basic":
+		scheme = yamlMap{{"type", "http"}, {"scheme", "basic"}}
+	default:
+		return ""
+	}
+
+	// endpoints may send the same strategy in different headers
+	name := auth.Type
+	for i := 2; ; i++ {
+		existing := o.security.get(name)
+		if existing == nil {
+			o.security.set(name, scheme)
+			return name
+		}
+		if reflect.DeepEqual(existing, scheme) {
+			return name
+		}
+		name = auth.Type + strconv.Itoa(i)
+	}
+}
+
+// fieldSchema describes the value of the field with its rules, form is set
+// for the values of params which differ from JSON for durations only:
+// they are sent like 1m30s in params and as nanoseconds in JSON
+func (o *openAPI) fieldSchema(f *field, form bool) yamlMap {
+	r := f.Rules
+	s := basicSchema(f.Kind)
+	value := func(lit string) interface{} {
+		return literalValue(f.Kind, lit)
+	}
+
+	duration := form && isDurationField(f)
+	if duration {
+		s = yamlMap{{"type", "string"}, {"format", "duration"}}
+		value = func(lit string) interface{} {
+			n, _ := strconv.ParseInt(lit, 10, 64)
+			return time.Duration(n).String()
+		}
+	}
+
+	switch {
+	case duration:
+	case f.Kind == "string":
+		if r.Min != "" {
+			s.set("minLength", yamlNumber(r.Min))
+		}
+		if r.Max != "" {
+			s.set("maxLength", yamlNumber(r.Max))
+		}
+		if r.Pattern != "" {
+			s.set("pattern", r.Pattern)
+		}
+		if r.Format != "" {
+			s.set("format", openAPIFormats[r.Format])
+		}
+	default:
+		if r.Min != "" {
+			s.set("minimum", yamlNumber(literal(f.Kind, r.Min)))
+		}
+		if r.Max != "" {
+			s.set("maximum", yamlNumber(literal(f.Kind, r.Max)))
+		}
+	}
+
+	if len(r.Enum) != 0 {
+		var enum []interface{}
+		for _, item := range r.Enum {
+			enum = append(enum, value(literal(f.Kind, item)))
+		}
+		s.set("enum", enum)
+	}
+
+	var dflt interface{}
+	if f.Default != nil {
+		dflt = value(f.Default[0])
+	}
+
+	if f.Slice {
+		s = yamlMap{
+			{"type", "array"},
+			{"items", s},
+		}
+		if r.MinItems != "" {
+			s.set("minItems", yamlNumber(r.MinItems))
+		}
+		if r.MaxItems != "" {
+			s.set("maxItems", yamlNumber(r.MaxItems))
+		}
+		if r.Unique {
+			s.set("uniqueItems", true)
+		}
+		if f.Default != nil {
+			var items []interface{}
+			for _, item := range f.Default {
+				items = append(items, value(item))
+			}
+			dflt = items
+		}
+	}
+
+	if dflt != nil {
+		s.set("default", dflt)
+	}
+
+	return s
+}
+
+// literalValue returns the YAML value of the Go literal of the kind
+func literalValue(kind, lit string) interface{} {
+	switch kind {
+	case "string":
+		value, _ := strconv.Unquote(lit)
+		return value
+	case "bool":
+		return lit == "true"
+	}
+
+	return yamlNumber(lit)
+}
+
+// basicSchema describes the values of the supported kind
+func basicSchema(kind string) yamlMap {
+	switch kind {
+	case "string":
+		return yamlMap{{"type", "string"}}
+	case "bool":
+		return yamlMap{{"type", "boolean"}}
+	case "float32":
+		return yamlMap{{"type", "number"}, {"format", "float"}}
+	case "float64":
+		return yamlMap{{"type", "number"}, {"format", "double"}}
+	case "int32", "int64":
+		return yamlMap{{"type", "integer"}, {"format", kind}}
+	case "uint", "uint8", "uint16", "uint32", "uint64":
+		return yamlMap{{"type", "integer"}, {"minimum", 0}}
+	case "":
+		return yamlMap{}
+	}
+
+	return yamlMap{{"type", "integer"}}
+}
+
+// schema describes the values of the type as encoding/json writes them,
+// named structs are described once in the components
+func (o *openAPI) schema(t types.Type) yamlMap {
+	switch t := types.Unalias(t).(type) {
+	case *types.Named:
+		if s := o.namedSchema(t); s != nil {
+			return s
+		}
+		if st, ok := t.Underlying().(*types.Struct); ok && t.TypeArgs().Len() == 0 {
+			return schemaRef(o.component(t, st))
+		}
+		return o.schema(t.Underlying())
+	case *types.Pointer:
+		return o.schema(t.Elem())
+	case *types.Basic:
+		return basicSchema(basicName(t))
+	case *types.Slice:
+		if basic, ok := types.Unalias(t.Elem()).(*types.Basic); ok && basic.Kind() == types.Byte {
+			return yamlMap{{"type", "string"}, {"format", "byte"}}
+		}
+		return yamlMap{{"type", "array"}, {"items", o.schema(t.Elem())}}
+	case *types.Array:
+		return yamlMap{{"type", "array"}, {"items", o.schema(t.Elem())}}
+	case *types.Map:
+		return yamlMap{{"type", "object"}, {"additionalProperties", o.schema(t.Elem())}}
+	case *types.Struct:
+		return o.objectSchema(t, "", nil)
+	}
+
+	return yamlMap{}
+}
+
+// namedSchema describes the named types encoding/json writes in their own way
+func (o *openAPI) namedSchema(t *types.Named) yamlMap {
+	switch jsonEncoding(t) {
+	case jsonTime:
+		return yamlMap{{"type", "string"}, {"format", "date-time"}}
+	case jsonMarshaler:
+		return yamlMap{}
+	case jsonText:
+		return yamlMap{{"type", "string"}}
+	}
+
+	return nil
+}
+
+// component adds the schema of the named struct to the components
+// and returns its name, types of other packages are prefixed
+// with the package name if the name is taken
+func (o *openAPI) component(t *types.Named, st *types.Struct) string {
+	take := func() string {
+		obj := t.Obj()
+		if o.schemas.get(obj.Name()) != nil && obj.Pkg() != nil {
+			return obj.Pkg().Name() + "." + obj.Name()
+		}
+		return obj.Name()
+	}
+
+	return o.names.name(t, take, func(name string) {
+		o.schemas.set(name, yamlMap{})
+		o.schemas.set(name, o.objectSchema(st, "", nil))
+	})
+}
+
+// objectSchema describes the struct as encoding/json writes it.
+// fields are the params filled from the request by their Go names prefixed
+// with path, if they are set the rules of the fields are described,
+// nested structs are described in place and only the fields with
+// the required rule are required
+func (o *openAPI) objectSchema(st *types.Struct, path string, fields map[string]*field) yamlMap {
+	properties := yamlMap{}
+	var required []interface{}
+	o.properties(st, path, fields, &properties, &required)
+
+	s := yamlMap{
+		{"type", "object"},
+		{"properties", properties},
+	}
+	if required != nil {
+		s.set("required", required)
+	}
+
+	return s
+}
+
+func (o *openAPI) properties(st *types.Struct, path string, fields map[string]*field, properties *yamlMap, required *[]interface{}) {
+	for _, jf := range jsonFields(st, path) {
+		var s yamlMap
+		f := fields[jf.Path]
+		switch {
+		case f != nil && f.Rules.Source == "path":
+			// path params are taken from the url
+			continue
+		case f != nil && f.Fields != nil:
+			s = o.objectSchema(f.Type.Underlying().(*types.Struct), f.Name+".", fields)
+		case f != nil:
+			s = o.fieldSchema(f, false)
+		default:
+			s = o.schema(jf.Var.Type())
+		}
+		if jf.String {
+			s = yamlMap{{"type", "string"}}
+		}
+		properties.set(jf.Key, s)
+
+		if fields == nil && !jf.OmitEmpty || f != nil && f.Rules.Required && f.Default == nil {
+			*required = append(*required, jf.Key)
+		}
+	}
+}
+
+func schemaRef(name string) yamlMap {
+	return yamlMap{{"$ref", "#/components/schemas/" + name}}
+}
+
+// docText returns the doc comment of the endpoint up to its annotation
+func docText(doc *ast.CommentGroup) string {
+	if doc == nil {
+		return ""
+	}
+
+	var lines []string
+	for _, comment := range doc.List {
+		text, _ := commentText(comment)
+		text = strings.TrimSpace(text)
+		if strings.HasPrefix(text, apiPrefix) {
+			break
+		}
+		lines = append(lines, text)
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// goPackage is a parsed Go package the handlers are generated for
+type goPackage struct {
+	Name  string
+	Path  string
+	Dir   string
+	Files []*ast.File
+}
+
+// loadPackage parses all non-test Go files of the package pointed by target.
+// target may be a directory, an import path or a single .go file, in the
+// last case the whole package of that file is loaded.
+// skip are the paths of the files generator writes to, they are never parsed,
+// so stale output from the previous run doesn't get into the analysis.
+func loadPackage(fSet *token.FileSet, target string, skip ...string) (*goPackage, error) {
+	bp, err := importPackage(target)
+	if err != nil {
+		return nil, err
+	}
+
+	skipAbs := make(map[string]bool)
+	for _, path := range skip {
+		if path == "" {
+			continue
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		skipAbs[abs] = true
+	}
+
+	pkg := &goPackage{
+		Name: bp.Name,
+		Path: bp.ImportPath,
+		Dir:  bp.Dir,
+	}
+
+	// files are parsed in the order of their names, so the positions
+	// of declarations follow the source and the output doesn't churn
+	names := append([]string(nil), bp.GoFiles...)
+	sort.Strings(names)
+	for _, name := range names {
+		fileName := filepath.Join(bp.Dir, name)
+
+		fileAbs, err := filepath.Abs(fileName)
+		if err != nil {
+			return nil, err
+		}
+		if skipAbs[fileAbs] {
+			continue
+		}
+
+		file, err := parser.ParseFile(fSet, fileName, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+
+		pkg.Files = append(pkg.Files, file)
+	}
+
+	if len(pkg.Files) == 0 {
+		return nil, fmt.Errorf("no Go files to parse in %s", bp.Dir)
+	}
+
+	return pkg, nil
+}
+
+func importPackage(target string) (*build.Package, error) {
+	if strings.HasSuffix(target, ".go") {
+		info, err := os.Stat(target)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			target = filepath.Dir(target)
+		}
+	}
+
+	if info, err := os.Stat(target); err == nil && info.IsDir() {
+		return build.ImportDir(target, 0)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	return build.Import(target, cwd, 0)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// route is an endpoint url with {name} placeholders matched by a regexp
+type route struct {
+	Pattern string
+	Params  []routeParam
+	// Path is the url with the constraints of placeholders removed,
+	// like the path templates of OpenAPI
+	Path string
+}
+
+// routeParam is a placeholder of the route with the index of its submatch
+type routeParam struct {
+	Name  string
+	Index int
+}
+
+// placeholder constraints which have a name, any other one is a regexp
+var routeConstraints = map[string]string{
+	"":     `[^/]+`,
+	"int":  `-?[0-9]+`,
+	"uint": `[0-9]+`,
+}
+
+var routeParamName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_.]*$`)
+
+// parseRoute parses urls like /user/{login}/posts/{id:int} or /files/{name:[a-z]+\.txt},
+// nil is returned for urls without placeholders
+func parseRoute(url string) (*route, error) {
+	if !strings.Contains(url, "{") {
+		if strings.Contains(url, "}") {
+			return nil, fmt.Errorf("unexpected } in url %s", url)
+		}
+		return nil, nil
+	}
+
+	var pattern, path strings.Builder
+	var names []string
+	pattern.WriteString("^")
+
+	for rest := url; rest != ""; {
+		open := strings.Index(rest, "{")
+		if open == -1 {
+			pattern.WriteString(regexp.QuoteMeta(rest))
+			path.WriteString(rest)
+			break
+		}
+		pattern.WriteString(regexp.QuoteMeta(rest[:open]))
+		path.WriteString(rest[:open])
+
+		// constraints may have braces too, e.g. {code:[0-9]{3}}
+		depth, end := 0, -1
+		for i := open; i < len(rest) && end == -1; i++ {
+			switch rest[i] {
+			case '{':
+				depth++
+			case '}':
+				depth--
+				if depth == 0 {
+					end = i
+				}
+			}
+		}
+		if end == -1 {
+			return nil, fmt.Errorf("unclosed { in url %s", url)
+		}
+
+		name, constraint, _ := strings.Cut(rest[open+1:end], ":")
+		if !routeParamName.MatchString(name) {
+			return nil, fmt.Errorf("bad placeholder name %q in url %s", name, url)
+		}
+		for _, taken := range names {
+			if taken == name {
+				return nil, fmt.Errorf("duplicate placeholder %s in url %s", name, url)
+			}
+		}
+		names = append(names, name)
+
+		expr, named := routeConstraints[constraint]
+		if !named {
+			if _, err := regexp.Compile(constraint); err != nil {
+				return nil, fmt.Errorf("bad constraint of placeholder %s: %v", name, err)
+			}
+			expr = constraint
+		}
+		fmt.Fprintf(&pattern, "(?P<%s>%s)", groupName(len(names)-1), expr)
+		fmt.Fprintf(&path, "{%s}", name)
+
+		rest = rest[end+1:]
+	}
+	pattern.WriteString("$")
+
+	re, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return nil, fmt.Errorf("bad url %s: %v", url, err)
+	}
+
+	r := &route{Pattern: pattern.String(), Path: path.String()}
+	for i, name := range names {
+		r.Params = append(r.Params, routeParam{
+			Name:  name,
+			Index: re.SubexpIndex(groupName(i)),
+		})
+	}
+
+	return r, nil
+}
+
+// groupName names submatches by their positions
+// as placeholder names may be not valid group names
+func groupName(i int) string {
+	return fmt.Sprintf("p%d", i)
+}
+
+func (r *route) hasParam(name string) bool {
+	for _, param := range r.Params {
+		if param.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pathPart is the text of the url of an endpoint followed by a placeholder,
+// the last part has the text after the last placeholder only
+type pathPart struct {
+	Text  string
+	Param string
+	// Field is the path param filling the placeholder,
+	// nil if clients take its value as an arg
+	Field *field
+}
+
+// pathParts splits the url of the endpoint with placeholders by them
+func pathParts(ep *endpoint) []pathPart {
+	var parts []pathPart
+	rest := ep.Route.Path
+	for _, rp := range ep.Route.Params {
+		placeholder := "{" + rp.Name + "}"
+		i := strings.Index(rest, placeholder)
+		part := pathPart{Text: rest[:i], Param: rp.Name}
+		rest = rest[i+len(placeholder):]
+
+		for _, f := range ep.Params.Fields {
+			if f.Rules.Source == "path" && f.Param == rp.Name {
+				part.Field = f
+			}
+		}
+		parts = append(parts, part)
+	}
+
+	return append(parts, pathPart{Text: rest})
+}
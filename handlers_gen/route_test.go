@@ -0,0 +1,79 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRoute(t *testing.T) {
+	cases := []struct {
+		URL     string
+		Pattern string
+		Path    string
+		Params  []routeParam
+		Err     bool
+	}{
+		{
+			URL: "/user/profile",
+		},
+		{
+			URL:     "/user/{login}/profile",
+			Pattern: `^/user/(?P<p0>[^/]+)/profile$`,
+			Path:    "/user/{login}/profile",
+			Params:  []routeParam{{Name: "login", Index: 1}},
+		},
+		{
+			URL:     "/posts/{id:int}.json",
+			Pattern: `^/posts/(?P<p0>-?[0-9]+)\.json$`,
+			Path:    "/posts/{id}.json",
+			Params:  []routeParam{{Name: "id", Index: 1}},
+		},
+		{
+			URL:     "/codes/{kind:(a|b)}/{code:[0-9]{3}}",
+			Pattern: `^/codes/(?P<p0>(a|b))/(?P<p1>[0-9]{3})$`,
+			Path:    "/codes/{kind}/{code}",
+			Params:  []routeParam{{Name: "kind", Index: 1}, {Name: "code", Index: 3}},
+		},
+		{
+			URL: "/user/{login",
+			Err: true,
+		},
+		{
+			URL: "/user/{login}/{login}",
+			Err: true,
+		},
+		{
+			URL: "/user/{login:[a-z}",
+			Err: true,
+		},
+		{
+			URL: "/user/{}",
+			Err: true,
+		},
+	}
+
+	for _, item := range cases {
+		r, err := parseRoute(item.URL)
+		if item.Err {
+			if err == nil {
+				t.Errorf("[%s] expected error, got route %+v", item.URL, r)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%s] unexpected error: %v", item.URL, err)
+			continue
+		}
+
+		if item.Pattern == "" {
+			if r != nil {
+				t.Errorf("[%s] expected static url, got route %+v", item.URL, r)
+			}
+			continue
+		}
+
+		if r.Pattern != item.Pattern || r.Path != item.Path || !reflect.DeepEqual(r.Params, item.Params) {
+			t.Errorf("[%s] routes not match\nGot: %+v\nExpected: %s %s %+v", item.URL, r, item.Pattern, item.Path, item.Params)
+		}
+	}
+}
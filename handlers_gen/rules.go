@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// rules are the parsed apivalidator tag of a field
+type rules struct {
+	Required  bool
+	ParamName string
+	Enum      []string
+	Default   string
+	Min       string
+	Max       string
+	// Source is where the value is taken from, "path" for url placeholders,
+	// by default it is the form or JSON body
+	Source string
+
+	// collection rules, min and max are applied to every item
+	MinItems string
+	MaxItems string
+	Unique   bool
+	CSV      bool
+
+	// string rules, normalizers are applied before the checks
+	Pattern   string
+	Format    string
+	Trim      bool
+	Lowercase bool
+
+	// Validate is a method of the service or a package func
+	// func(context.Context, T) error checking the value
+	Validate string
+
+	// cross-field rules reference other fields of the struct by Go name,
+	// they are checked after all fields of the struct
+	RequiredIf      string
+	RequiredIfValue string
+	RequiredWithout string
+	EqField         string
+	GtField         string
+}
+
+// patternRule starts the pattern rule, its value may contain commas
+// so unless it is quoted like pattern='^[a-z]+$' it takes the rest of the tag
+var patternRule = regexp.MustCompile(`(^|,)\s*pattern=`)
+
+// ruleNames are the rules which may follow the pattern rule,
+// the unquoted pattern can't tell them from a part of the regexp
+var ruleNames = []string{
+	"required", "unique", "csv", "trim", "lowercase", "format", "validate",
+	"required_if", "required_without", "eqfield", "gtfield", "paramname",
+	"enum", "default", "min", "max", "source", "minItems", "maxItems",
+}
+
+// formats are the values of the format rule
+var formats = []string{"email", "uuid", "url", "ipv4", "date-time"}
+
+// parseRules parses an apivalidator tag like "required,min=10,paramname=login"
+func parseRules(tag string) (*rules, error) {
+	r := &rules{}
+
+	if loc := patternRule.FindStringIndex(tag); loc != nil {
+		var err error
+		r.Pattern, tag, err = cutPattern(tag[:loc[0]], tag[loc[1]:])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, item := range strings.Split(tag, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		key, value, hasValue := strings.Cut(item, "=")
+		if hasValue && value == "" {
+			return nil, fmt.Errorf("rule %s has empty value", key)
+		}
+
+		switch key {
+		case "required":
+			r.Required = true
+			continue
+		case "unique":
+			r.Unique = true
+			continue
+		case "csv":
+			r.CSV = true
+			continue
+		case "trim":
+			r.Trim = true
+			continue
+		case "lowercase":
+			r.Lowercase = true
+			continue
+		case "format":
+			r.Format = value
+		case "validate":
+			r.Validate = value
+		case "required_if":
+			r.RequiredIf, r.RequiredIfValue, _ = strings.Cut(value, ":")
+			if hasValue && (r.RequiredIf == "" || r.RequiredIfValue == "") {
+				return nil, fmt.Errorf("rule required_if must be like required_if=Field:value")
+			}
+		case "required_without":
+			r.RequiredWithout = value
+		case "eqfield":
+			r.EqField = value
+		case "gtfield":
+			r.GtField = value
+		case "paramname":
+			r.ParamName = value
+		case "enum":
+			r.Enum = strings.Split(value, "|")
+		case "default":
+			r.Default = value
+		case "min":
+			r.Min = value
+		case "max":
+			r.Max = value
+		case "source":
+			r.Source = value
+		case "minItems":
+			r.MinItems = value
+		case "maxItems":
+			r.MaxItems = value
+		default:
+			return nil, fmt.Errorf("unknown rule %s", key)
+		}
+
+		if !hasValue {
+			return nil, fmt.Errorf("rule %s must have a value", key)
+		}
+	}
+
+	return r, nil
+}
+
+// cutPattern returns the value of the pattern rule and the tag without it,
+// the quoted value ends with a quote followed by a comma or the end of the tag
+func cutPattern(before, value string) (string, string, error) {
+	if strings.HasPrefix(value, "'") {
+		for i := 1; i < len(value); i++ {
+			if value[i] == '\'' && (i == len(value)-1 || value[i+1] == ',') {
+				if i == 1 {
+					return "", "", fmt.Errorf("rule pattern has empty value")
+				}
+				return value[1:i], before + value[i+1:], nil
+			}
+		}
+		return "", "", fmt.Errorf("rule pattern has unclosed quote")
+	}
+
+	if value == "" {
+		return "", "", fmt.Errorf("rule pattern has empty value")
+	}
+	for i, item := range strings.Split(value, ",") {
+		key, _, _ := strings.Cut(strings.TrimSpace(item), "=")
+		if i > 0 && contains(ruleNames, key) {
+			return "", "", fmt.Errorf("rule pattern takes the rest of the tag including %s, quote it like pattern='...' to follow it with rules", key)
+		}
+	}
+
+	return value, before, nil
+}
+
+// checkValue checks that the value of a required_if rule fits the field of the given kind
+func checkValue(kind, value string) error {
+	switch kind {
+	case "string":
+		return nil
+	case "bool":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%s is not a valid bool", value)
+		}
+		return nil
+	}
+
+	return checkBound(kind, value)
+}
+
+// literal returns the Go literal of the value checked with checkValue
+func literal(kind, value string) string {
+	switch kinds[kind].Parser {
+	case "":
+		return strconv.Quote(value)
+	case "ParseBool":
+		b, _ := strconv.ParseBool(value)
+		return strconv.FormatBool(b)
+	case "ParseInt":
+		// 010 is an octal literal in Go, so the parsed value is formatted back
+		n, _ := strconv.ParseInt(value, 10, 64)
+		return strconv.FormatInt(n, 10)
+	case "ParseUint":
+		n, _ := strconv.ParseUint(value, 10, 64)
+		return strconv.FormatUint(n, 10)
+	}
+
+	n, _ := strconv.ParseFloat(value, 64)
+	return strconv.FormatFloat(n, 'g', -1, 64)
+}
+
+// kindInfo describes how a basic type is parsed from a form value
+type kindInfo struct {
+	Parser string
+	Bits   int
+}
+
+var kinds = map[string]kindInfo{
+	"string":  {},
+	"bool":    {Parser: "ParseBool"},
+	"int":     {Parser: "ParseInt", Bits: 0},
+	"int8":    {Parser: "ParseInt", Bits: 8},
+	"int16":   {Parser: "ParseInt", Bits: 16},
+	"int32":   {Parser: "ParseInt", Bits: 32},
+	"int64":   {Parser: "ParseInt", Bits: 64},
+	"uint":    {Parser: "ParseUint", Bits: 0},
+	"uint8":   {Parser: "ParseUint", Bits: 8},
+	"uint16":  {Parser: "ParseUint", Bits: 16},
+	"uint32":  {Parser: "ParseUint", Bits: 32},
+	"uint64":  {Parser: "ParseUint", Bits: 64},
+	"float32": {Parser: "ParseFloat", Bits: 32},
+	"float64": {Parser: "ParseFloat", Bits: 64},
+}
+
+// checkBound checks that min or max value fits the field of the given kind,
+// for strings it is a length so it must be a non-negative int
+func checkBound(kind, value string) error {
+	if value == "" {
+		return nil
+	}
+
+	var err error
+	switch kinds[kind].Parser {
+	case "":
+		_, err = strconv.ParseUint(value, 10, 0)
+	case "ParseInt":
+		_, err = strconv.ParseInt(value, 10, kinds[kind].Bits)
+	case "ParseUint":
+		_, err = strconv.ParseUint(value, 10, kinds[kind].Bits)
+	case "ParseFloat":
+		_, err = strconv.ParseFloat(value, kinds[kind].Bits)
+	default:
+		return fmt.Errorf("min and max are not supported for %s", kind)
+	}
+	if err != nil {
+		if kind == "string" {
+			return fmt.Errorf("%s is not a valid length", value)
+		}
+		return fmt.Errorf("%s is not a valid %s", value, kind)
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRules(t *testing.T) {
+	cases := []struct {
+		Tag   string
+		Rules *rules
+		Err   bool
+	}{
+		{
+			Tag:   "required,min=10,paramname=login",
+			Rules: &rules{Required: true, Min: "10", ParamName: "login"},
+		},
+		{
+			Tag:   "trim,lowercase,format=email",
+			Rules: &rules{Trim: true, Lowercase: true, Format: "email"},
+		},
+		{
+			Tag:   "required,pattern=^[a-z]{3,8}$",
+			Rules: &rules{Required: true, Pattern: "^[a-z]{3,8}$"},
+		},
+		{
+			Tag:   "pattern=^(a|b),c$",
+			Rules: &rules{Pattern: "^(a|b),c$"},
+		},
+		{
+			Tag:   "pattern='^[a-z]+$',required,min=3",
+			Rules: &rules{Pattern: "^[a-z]+$", Required: true, Min: "3"},
+		},
+		{
+			Tag:   "required,pattern='^(a|b),c$'",
+			Rules: &rules{Required: true, Pattern: "^(a|b),c$"},
+		},
+		{ // the unquoted pattern can't be followed by rules
+			Tag: "pattern=^[a-z]+$,required,min=3",
+			Err: true,
+		},
+		{
+			Tag: "pattern='^[a-z]+$,required",
+			Err: true,
+		},
+		{
+			Tag: "pattern='',required",
+			Err: true,
+		},
+		{
+			Tag:   "required,validate=checkLogin",
+			Rules: &rules{Required: true, Validate: "checkLogin"},
+		},
+		{
+			Tag:   "required_if=Status:admin,eqfield=Password",
+			Rules: &rules{RequiredIf: "Status", RequiredIfValue: "admin", EqField: "Password"},
+		},
+		{
+			Tag: "required_if=Status",
+			Err: true,
+		},
+		{
+			Tag: "required,pattern=",
+			Err: true,
+		},
+		{
+			Tag: "format",
+			Err: true,
+		},
+		{
+			Tag: "trimmed",
+			Err: true,
+		},
+	}
+
+	for _, item := range cases {
+		r, err := parseRules(item.Tag)
+		if item.Err {
+			if err == nil {
+				t.Errorf("[%s] expected error, got rules %+v", item.Tag, r)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%s] unexpected error: %v", item.Tag, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(r, item.Rules) {
+			t.Errorf("[%s] rules not match\nGot: %+v\nExpected: %+v", item.Tag, r, item.Rules)
+		}
+	}
+}
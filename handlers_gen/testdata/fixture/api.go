@@ -0,0 +1,338 @@
+// Package fixture uses every rule of the generator, the golden test
+// generates the code for it and runs its tests against the generated handlers
+package fixture
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ApiError struct {
+	HTTPStatus int
+	Err        error
+}
+
+func (ae ApiError) Error() string {
+	return ae.Err.Error()
+}
+
+// ----------------
+
+type Sort string
+
+const (
+	SortName  Sort = "name"
+	SortPrice Sort = "price"
+)
+
+type Level int8
+
+const (
+	LevelLow Level = iota + 1
+	LevelHigh
+)
+
+type ListParams struct {
+	Query   string        `apivalidator:"trim,lowercase,max=20"`
+	Tags    []string      `apivalidator:"maxItems=3,unique,min=2"`
+	IDs     []int         `apivalidator:"paramname=ids,csv,min=1"`
+	Sort    Sort          `apivalidator:"default=name"`
+	Levels  []Level       `apivalidator:""`
+	Month   time.Month    `apivalidator:""`
+	Limit   uint16        `apivalidator:"default=10,min=1,max=100"`
+	Offset  int64         `apivalidator:"min=0"`
+	Ratio   float32       `apivalidator:"min=0,max=1"`
+	InStock *bool         `apivalidator:"paramname=in_stock,default=true"`
+	Timeout time.Duration `apivalidator:"default=1s,max=10000000000"`
+}
+
+type ItemID struct {
+	ID int `apivalidator:"source=path,min=1"`
+}
+
+type Money struct {
+	Amount   float64 `apivalidator:"required,min=0.01"`
+	Currency string  `apivalidator:"enum=usd|eur,default=usd"`
+}
+
+type Discount struct {
+	Percent uint8  `apivalidator:"required,min=1,max=90"`
+	Code    string `apivalidator:"pattern=^[A-Z0-9]{4,8}$"`
+}
+
+type NewItem struct {
+	SKU      string    `json:"sku" apivalidator:"required,pattern=^[A-Z]{3}-[0-9]{4}$"`
+	Name     string    `json:"name" apivalidator:"required,trim,validate=checkName"`
+	Image    *string   `json:"image" apivalidator:"format=url"`
+	Price    Money     `json:"price" apivalidator:""`
+	Discount *Discount `json:"discount" apivalidator:""`
+	MinQty   int       `json:"min_qty" apivalidator:"paramname=min_qty,default=1,min=1"`
+	MaxQty   *int      `json:"max_qty" apivalidator:"paramname=max_qty,gtfield=MinQty"`
+}
+
+// Validate is called after the fields are checked
+func (in NewItem) Validate() error {
+	if in.Discount != nil && in.Price.Amount < 1 {
+		return errors.New("items cheaper than 1 can't have a discount")
+	}
+
+	return nil
+}
+
+type Item struct {
+	ID   int     `json:"id"`
+	SKU  string  `json:"sku"`
+	Name string  `json:"name"`
+	Cost float64 `json:"cost"`
+}
+
+type ListResult struct {
+	Params ListParams `json:"params"`
+	Items  []*Item    `json:"items"`
+}
+
+// Catalog replies with the errors of all params
+//
+// apigen:service {"errors": "all"}
+type Catalog struct {
+	items  map[int]*Item
+	nextID int
+	mu     sync.Mutex
+}
+
+func NewCatalog() *Catalog {
+	return &Catalog{
+		items: map[int]*Item{
+			1: {ID: 1, SKU: "ABC-0001", Name: "pen", Cost: 1.5},
+		},
+		nextID: 2,
+	}
+}
+
+// apigen:api {"url": "/items", "method": "GET"}
+func (srv *Catalog) List(ctx context.Context, in ListParams) (*ListResult, error) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	res := &ListResult{Params: in}
+	for id := 1; id < srv.nextID; id++ {
+		if item, exists := srv.items[id]; exists {
+			res.Items = append(res.Items, item)
+		}
+	}
+
+	return res, nil
+}
+
+// apigen:api {"url": "/items/{id:int}", "method": "GET"}
+func (srv *Catalog) Get(ctx context.Context, in ItemID) (*Item, error) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	item, exists := srv.items[in.ID]
+	if !exists {
+		return nil, ApiError{http.StatusNotFound, fmt.Errorf("item %d not found", in.ID)}
+	}
+
+	return item, nil
+}
+
+// apigen:api {"url": "/items/{id:int}", "method": "DELETE", "auth": {"type": "bearer"}}
+func (srv *Catalog) Delete(ctx context.Context, in ItemID) (bool, error) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	_, exists := srv.items[in.ID]
+	delete(srv.items, in.ID)
+
+	return exists, nil
+}
+
+// apigen:api {"url": "/items", "method": ["POST", "PUT"], "auth": {"type": "bearer"}, "middleware": ["noCache", "Count"]}
+func (srv *Catalog) Create(ctx context.Context, in NewItem) (*Item, error) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	item := &Item{
+		ID:   srv.nextID,
+		SKU:  in.SKU,
+		Name: in.Name,
+		Cost: in.Price.Amount,
+	}
+	if in.Discount != nil {
+		item.Cost = in.Price.Amount * float64(100-in.Discount.Percent) / 100
+	}
+	srv.items[item.ID] = item
+	srv.nextID++
+
+	return item, nil
+}
+
+// apigen:api {"url": "/items/{name}/similar", "method": "GET"}
+func (srv *Catalog) Similar(ctx context.Context, in struct {
+	Name  string `apivalidator:"source=path"`
+	Limit int    `apivalidator:"default=5,max=10"`
+}) ([]string, error) {
+	return []string{in.Name, fmt.Sprint(in.Limit)}, nil
+}
+
+func (srv *Catalog) checkName(ctx context.Context, name string) error {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	for _, item := range srv.items {
+		if strings.EqualFold(item.Name, name) {
+			return fmt.Errorf("name %s is taken", name)
+		}
+	}
+
+	return nil
+}
+
+// Count counts the requests creating items in the X-Count header
+func (srv *Catalog) Count(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.mu.Lock()
+		w.Header().Set("X-Count", fmt.Sprint(srv.nextID))
+		srv.mu.Unlock()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func noCache(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ----------------
+
+type Account struct {
+	Login  string   `json:"login"`
+	Roles  []string `json:"roles"`
+	Scopes []string `json:"scopes"`
+}
+
+// Principal is the account a request is authenticated as
+type Principal struct {
+	Account *Account
+}
+
+func (p Principal) Roles() []string {
+	return p.Account.Roles
+}
+
+func (p Principal) Scopes() []string {
+	return p.Account.Scopes
+}
+
+type RegisterParams struct {
+	Login    string `apivalidator:"required,trim,lowercase,min=3,pattern=^[a-z][a-z0-9]*$"`
+	Kind     string `apivalidator:"enum=person|company,default=person"`
+	Company  string `apivalidator:"required_if=Kind:company"`
+	Email    string `apivalidator:"format=email"`
+	Phone    string `apivalidator:"required_without=Email,pattern=^\\+[0-9]{11}$"`
+	Password string `apivalidator:"required,min=8"`
+	Confirm  string `apivalidator:"eqfield=Password"`
+	Site     string `apivalidator:"format=url"`
+	ID       string `apivalidator:"format=uuid"`
+	IP       string `apivalidator:"format=ipv4"`
+	Born     string `apivalidator:"format=date-time"`
+}
+
+type BlockParams struct {
+	Login string `apivalidator:"source=path,min=3"`
+	Days  int    `apivalidator:"required,min=1,max=365"`
+}
+
+// Accounts authenticate users by the X-User header themselves
+//
+// apigen:auth {"type": "method"}
+type Accounts struct {
+	accounts map[string]*Account
+	mu       sync.Mutex
+}
+
+func NewAccounts() *Accounts {
+	return &Accounts{
+		accounts: map[string]*Account{
+			"admin":   {Login: "admin", Roles: []string{"admin"}, Scopes: []string{"audit"}},
+			"auditor": {Login: "auditor", Scopes: []string{"audit", "read"}},
+			"user":    {Login: "user"},
+		},
+	}
+}
+
+func (srv *Accounts) Authenticate(ctx context.Context, r *http.Request) (Principal, error) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	account, exists := srv.accounts[r.Header.Get("X-User")]
+	if !exists {
+		return Principal{}, errors.New("unknown user")
+	}
+
+	return Principal{Account: account}, nil
+}
+
+// apigen:api {"url": "/accounts", "method": "POST", "auth": {"type": "apikey", "query": "key"}}
+func (srv *Accounts) Register(ctx context.Context, in RegisterParams) (*Account, error) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	if _, exists := srv.accounts[in.Login]; exists {
+		return nil, ApiError{http.StatusConflict, fmt.Errorf("login %s is taken", in.Login)}
+	}
+	account := &Account{Login: in.Login}
+	srv.accounts[in.Login] = account
+
+	return account, nil
+}
+
+// apigen:api {"url": "/accounts/me", "method": "GET", "auth": true}
+func (srv *Accounts) Me(ctx context.Context, in struct{}) (*Account, error) {
+	principal, _ := PrincipalFromContext(ctx)
+
+	return principal.(Principal).Account, nil
+}
+
+// apigen:api {"url": "/accounts/{login}/block", "method": "POST", "auth": true, "roles": ["admin", "moderator"]}
+func (srv *Accounts) Block(ctx context.Context, in BlockParams) (string, error) {
+	return fmt.Sprintf("%s is blocked for %d days", in.Login, in.Days), nil
+}
+
+// apigen:api {"url": "/accounts/audit", "method": "GET", "auth": true, "scopes": ["audit", "read"]}
+func (srv *Accounts) Audit(ctx context.Context, in struct{}) (int, error) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	return len(srv.accounts), nil
+}
+
+// apigen:api {"url": "/accounts/export", "method": "GET", "auth": {"type": "basic"}}
+func (srv *Accounts) Export(ctx context.Context, in struct{}) (string, error) {
+	principal, _ := PrincipalFromContext(ctx)
+
+	return principal.(StaticPrincipal).Name, nil
+}
+
+// apigen:api {"url": "/accounts/ping", "auth": {"type": "token"}}
+func (srv *Accounts) Ping(ctx context.Context, in struct{}) (string, error) {
+	return "pong", nil
+}
+
+// apigen:api {"url": "/accounts/panic", "method": "GET"}
+func (srv *Accounts) Panic(ctx context.Context, in struct{}) (string, error) {
+	panic("accounts are broken")
+}
+
+// apigen:api {"url": "/accounts/slow", "method": "GET"}
+func (srv *Accounts) Slow(ctx context.Context, in struct{}) (string, error) {
+	return "", fmt.Errorf("accounts db: %w", context.DeadlineExceeded)
+}
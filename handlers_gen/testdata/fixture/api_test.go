@@ -0,0 +1,588 @@
+package fixture
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// secrets of the static auth strategies
+const (
+	secretToken = "token-secret"
+	secretBasic = "alice:basic-secret"
+	secretKey   = "key-secret"
+)
+
+type Case struct {
+	Method string
+	Path   string
+	// Query is sent in the body of POST and PUT requests
+	Query string
+	// Body is sent instead of Query with ContentType if it is set
+	Body        string
+	ContentType string
+	Header      map[string]string
+	Status      int
+	// Result is the expected body, it isn't checked if it is nil
+	Result interface{}
+	// ResponseHeader are the expected headers of the response
+	ResponseHeader map[string]string
+}
+
+// CR is a JSON object of the response
+type CR map[string]interface{}
+
+func TestMain(m *testing.M) {
+	os.Setenv("API_AUTH_TOKEN", secretToken)
+	os.Setenv("API_AUTH_BASIC", secretBasic)
+	os.Setenv("API_AUTH_KEY", secretKey)
+	os.Exit(m.Run())
+}
+
+var bearer = map[string]string{"Authorization": "Bearer " + secretToken}
+
+// listParams are the params of List with their defaults
+func listParams(changes CR) CR {
+	params := CR{
+		"Query":   "",
+		"Tags":    nil,
+		"IDs":     nil,
+		"Sort":    "name",
+		"Levels":  nil,
+		"Month":   0,
+		"Limit":   10,
+		"Offset":  0,
+		"Ratio":   0,
+		"InStock": true,
+		"Timeout": time.Second,
+	}
+	for key, value := range changes {
+		params[key] = value
+	}
+
+	return params
+}
+
+var pen = CR{"id": 1, "sku": "ABC-0001", "name": "pen", "cost": 1.5}
+
+func TestCatalog(t *testing.T) {
+	ts := httptest.NewServer(NewCatalogRouter(NewCatalog()))
+	defer ts.Close()
+
+	cases := []Case{
+		{ // defaults of every type
+			Method: http.MethodGet,
+			Path:   "/items",
+			Status: http.StatusOK,
+			Result: CR{"error": "", "response": CR{"params": listParams(nil), "items": []interface{}{pen}}},
+		},
+		{ // slices, csv, normalizers, kinds, const enums and durations
+			Method: http.MethodGet,
+			Path:   "/items",
+			Query:  "query=+Pen+&tags=aa&tags=bb&ids=1,2&ids=3&levels=2&month=3&limit=5&offset=-0&ratio=0.5&in_stock=false&timeout=2s&sort=price",
+			Status: http.StatusOK,
+			Result: CR{"error": "", "response": CR{
+				"params": listParams(CR{
+					"Query":   "pen",
+					"Tags":    []string{"aa", "bb"},
+					"IDs":     []int{1, 2, 3},
+					"Sort":    "price",
+					"Levels":  []int{2},
+					"Month":   3,
+					"Limit":   5,
+					"Ratio":   0.5,
+					"InStock": false,
+					"Timeout": 2 * time.Second,
+				}),
+				"items": []interface{}{pen},
+			}},
+		},
+		{ // errors of all params
+			Method: http.MethodGet,
+			Path:   "/items",
+			Query:  "tags=a&ids=1,x&levels=3&month=13&limit=101&offset=1.5&ratio=2&timeout=1h&sort=size&in_stock=maybe",
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "validation failed", "errors": []CR{
+				{"field": "tags", "rule": "min", "message": "tags len must be >= 2"},
+				{"field": "ids", "rule": "type", "message": "ids must be int"},
+				{"field": "sort", "rule": "enum", "message": "sort must be one of [name, price]"},
+				{"field": "levels", "rule": "enum", "message": "levels must be one of [1, 2]"},
+				{"field": "month", "rule": "enum", "message": "month must be one of [1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12]"},
+				{"field": "limit", "rule": "max", "message": "limit must be <= 100"},
+				{"field": "offset", "rule": "type", "message": "offset must be int64"},
+				{"field": "ratio", "rule": "max", "message": "ratio must be <= 1"},
+				{"field": "in_stock", "rule": "type", "message": "in_stock must be bool"},
+				{"field": "timeout", "rule": "max", "message": "timeout must be <= 10000000000"},
+			}},
+		},
+		{ // the first error of a field is replied
+			Method: http.MethodGet,
+			Path:   "/items",
+			Query:  "tags=aa&tags=bb&tags=cc&tags=dd&ids=0",
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "validation failed", "errors": []CR{
+				{"field": "tags", "rule": "maxItems", "message": "tags must contain <= 3 items"},
+				{"field": "ids", "rule": "min", "message": "ids must be >= 1"},
+			}},
+		},
+		{
+			Method: http.MethodGet,
+			Path:   "/items",
+			Query:  "tags=aa&tags=aa",
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "validation failed", "errors": []CR{
+				{"field": "tags", "rule": "unique", "message": "tags must contain unique items"},
+			}},
+		},
+		{ // the methods of all endpoints of the url are allowed
+			Method:         http.MethodOptions,
+			Path:           "/items",
+			Status:         http.StatusNoContent,
+			ResponseHeader: map[string]string{"Allow": "GET, POST, PUT, OPTIONS"},
+		},
+		{
+			Method:         http.MethodPatch,
+			Path:           "/items",
+			Status:         http.StatusMethodNotAllowed,
+			Result:         CR{"error": "bad method"},
+			ResponseHeader: map[string]string{"Allow": "GET, POST, PUT, OPTIONS"},
+		},
+		{ // path params
+			Method: http.MethodGet,
+			Path:   "/items/1",
+			Status: http.StatusOK,
+			Result: CR{"error": "", "response": pen},
+		},
+		{ // ApiError sets the status
+			Method: http.MethodGet,
+			Path:   "/items/7",
+			Status: http.StatusNotFound,
+			Result: CR{"error": "item 7 not found"},
+		},
+		{
+			Method: http.MethodGet,
+			Path:   "/items/0",
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "validation failed", "errors": []CR{
+				{"field": "id", "rule": "min", "message": "id must be >= 1"},
+			}},
+		},
+		{ // placeholders constrained to int don't match other values
+			Method: http.MethodGet,
+			Path:   "/items/pen",
+			Status: http.StatusNotFound,
+			Result: CR{"error": "unknown method"},
+		},
+		{ // escaped slashes are kept in placeholders
+			Method: http.MethodGet,
+			Path:   "/items/a%20b%2Fc/similar",
+			Status: http.StatusOK,
+			Result: CR{"error": "", "response": []string{"a b/c", "5"}},
+		},
+		{
+			Method:         http.MethodOptions,
+			Path:           "/items/1",
+			Status:         http.StatusNoContent,
+			ResponseHeader: map[string]string{"Allow": "GET, DELETE, OPTIONS"},
+		},
+		{ // endpoints sharing the url have their own auth
+			Method: http.MethodDelete,
+			Path:   "/items/1",
+			Status: http.StatusUnauthorized,
+			Result: CR{"error": "unauthorized"},
+		},
+		{
+			Method: http.MethodPost,
+			Path:   "/items",
+			Query:  "sku=ABC-0002&name=pencil&price.amount=2",
+			Header: map[string]string{"Authorization": "Bearer bad"},
+			Status: http.StatusUnauthorized,
+			Result: CR{"error": "unauthorized"},
+		},
+		{ // nested structs, pointer structs and middleware of the endpoint
+			Method: http.MethodPost,
+			Path:   "/items",
+			Query:  "sku=ABC-0002&name=+Pencil+&price.amount=2&discount.percent=10&max_qty=3",
+			Header: bearer,
+			Status: http.StatusOK,
+			Result: CR{"error": "", "response": CR{"id": 2, "sku": "ABC-0002", "name": "Pencil", "cost": 1.8}},
+			ResponseHeader: map[string]string{
+				"Cache-Control": "no-store",
+				"X-Count":       "2",
+			},
+		},
+		{ // JSON body
+			Method:      http.MethodPut,
+			Path:        "/items",
+			Body:        `{"sku": "ABC-0003", "name": "Marker", "price": {"amount": 3, "currency": "eur"}}`,
+			ContentType: "application/json",
+			Header:      bearer,
+			Status:      http.StatusOK,
+			Result:      CR{"error": "", "response": CR{"id": 3, "sku": "ABC-0003", "name": "Marker", "cost": 3}},
+		},
+		{ // pattern, format, validator, nested required and gtfield
+			Method: http.MethodPost,
+			Path:   "/items",
+			Query:  "sku=abc&name=PEN&image=not+url&price.currency=rub&discount.code=ab&min_qty=3&max_qty=2",
+			Header: bearer,
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "validation failed", "errors": []CR{
+				{"field": "sku", "rule": "pattern", "message": "sku must match ^[A-Z]{3}-[0-9]{4}$"},
+				{"field": "name", "rule": "validate", "message": "name PEN is taken"},
+				{"field": "image", "rule": "format", "message": "image must be a valid url"},
+				{"field": "price.amount", "rule": "required", "message": "price.amount must me not empty"},
+				{"field": "price.currency", "rule": "enum", "message": "price.currency must be one of [usd, eur]"},
+				{"field": "discount.percent", "rule": "required", "message": "discount.percent must me not empty"},
+				{"field": "discount.code", "rule": "pattern", "message": "discount.code must match ^[A-Z0-9]{4,8}$"},
+				{"field": "max_qty", "rule": "gtfield", "message": "max_qty must be greater than min_qty"},
+			}},
+		},
+		{ // Validate of the params
+			Method: http.MethodPost,
+			Path:   "/items",
+			Query:  "sku=ABC-0004&name=eraser&price.amount=0.5&discount.percent=5",
+			Header: bearer,
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "items cheaper than 1 can't have a discount"},
+		},
+		{
+			Method: http.MethodDelete,
+			Path:   "/items/1",
+			Header: bearer,
+			Status: http.StatusOK,
+			Result: CR{"error": "", "response": true},
+		},
+	}
+
+	runTests(t, ts, cases)
+}
+
+func TestAccounts(t *testing.T) {
+	ts := httptest.NewServer(NewAccountsRouter(NewAccounts()))
+	defer ts.Close()
+
+	register := "/accounts?key=" + secretKey
+	basic := strings.SplitN(secretBasic, ":", 2)
+
+	cases := []Case{
+		{ // apikey in the query
+			Method: http.MethodPost,
+			Path:   "/accounts",
+			Query:  "login=bob&email=bob@example.com&password=12345678",
+			Status: http.StatusUnauthorized,
+			Result: CR{"error": "unauthorized"},
+		},
+		{ // normalizers are applied before the checks
+			Method: http.MethodPost,
+			Path:   register,
+			Query:  "login=+Bob+&email=bob@example.com&password=12345678&confirm=12345678",
+			Status: http.StatusOK,
+			Result: CR{"error": "", "response": CR{"login": "bob", "roles": nil, "scopes": nil}},
+		},
+		{
+			Method: http.MethodPost,
+			Path:   register,
+			Query:  "login=admin&email=admin@example.com&password=12345678&confirm=12345678",
+			Status: http.StatusConflict,
+			Result: CR{"error": "login admin is taken"},
+		},
+		{ // the first error is replied
+			Method: http.MethodPost,
+			Path:   register,
+			Query:  "login=1bob&password=1234",
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "login must match ^[a-z][a-z0-9]*$"},
+		},
+		{
+			Method: http.MethodPost,
+			Path:   register,
+			Query:  "login=carol&kind=company&email=carol@example.com&password=12345678&confirm=12345678",
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "company is required when kind is company"},
+		},
+		{
+			Method: http.MethodPost,
+			Path:   register,
+			Query:  "login=carol&password=12345678&confirm=12345678",
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "phone is required when email is not set"},
+		},
+		{
+			Method: http.MethodPost,
+			Path:   register,
+			Query:  "login=carol&phone=%2B12345678901&password=12345678&confirm=87654321",
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "confirm must be equal to password"},
+		},
+		{
+			Method: http.MethodPost,
+			Path:   register,
+			Query:  "login=carol&phone=%2B12345678901&password=12345678&confirm=12345678&id=123",
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "id must be a valid uuid"},
+		},
+		{
+			Method: http.MethodPost,
+			Path:   register,
+			Query:  "login=carol&phone=%2B12345678901&password=12345678&confirm=12345678&ip=1.2.3",
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "ip must be a valid ipv4"},
+		},
+		{
+			Method: http.MethodPost,
+			Path:   register,
+			Query:  "login=carol&phone=%2B12345678901&password=12345678&confirm=12345678&born=yesterday",
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "born must be a valid date-time"},
+		},
+		{
+			Method: http.MethodPost,
+			Path:   register,
+			Query:  "login=carol&email=carol&password=12345678&confirm=12345678",
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "email must be a valid email"},
+		},
+		{ // method auth
+			Method: http.MethodGet,
+			Path:   "/accounts/me",
+			Header: map[string]string{"X-User": "user"},
+			Status: http.StatusOK,
+			Result: CR{"error": "", "response": CR{"login": "user", "roles": nil, "scopes": nil}},
+		},
+		{
+			Method: http.MethodGet,
+			Path:   "/accounts/me",
+			Status: http.StatusUnauthorized,
+			Result: CR{"error": "unknown user"},
+		},
+		{ // roles
+			Method: http.MethodPost,
+			Path:   "/accounts/bob/block",
+			Query:  "days=7",
+			Header: map[string]string{"X-User": "admin"},
+			Status: http.StatusOK,
+			Result: CR{"error": "", "response": "bob is blocked for 7 days"},
+		},
+		{
+			Method: http.MethodPost,
+			Path:   "/accounts/bob/block",
+			Query:  "days=7",
+			Header: map[string]string{"X-User": "user"},
+			Status: http.StatusForbidden,
+			Result: CR{"error": "forbidden"},
+		},
+		{
+			Method: http.MethodPost,
+			Path:   "/accounts/bo/block",
+			Header: map[string]string{"X-User": "admin"},
+			Status: http.StatusBadRequest,
+			Result: CR{"error": "login len must be >= 3"},
+		},
+		{ // scopes, bob is registered above
+			Method: http.MethodGet,
+			Path:   "/accounts/audit",
+			Header: map[string]string{"X-User": "auditor"},
+			Status: http.StatusOK,
+			Result: CR{"error": "", "response": 4},
+		},
+		{
+			Method: http.MethodGet,
+			Path:   "/accounts/audit",
+			Header: map[string]string{"X-User": "admin"},
+			Status: http.StatusForbidden,
+			Result: CR{"error": "scope read is required"},
+		},
+		{ // basic auth
+			Method: http.MethodGet,
+			Path:   "/accounts/export",
+			Header: map[string]string{"Authorization": "Basic " + basicAuth(basic[0], basic[1])},
+			Status: http.StatusOK,
+			Result: CR{"error": "", "response": "alice"},
+		},
+		{
+			Method:         http.MethodGet,
+			Path:           "/accounts/export",
+			Header:         map[string]string{"Authorization": "Basic " + basicAuth(basic[0], "bad")},
+			Status:         http.StatusUnauthorized,
+			ResponseHeader: map[string]string{"WWW-Authenticate": `Basic realm="api"`},
+		},
+		{ // token auth
+			Method: http.MethodGet,
+			Path:   "/accounts/ping",
+			Header: map[string]string{"X-Auth": secretToken},
+			Status: http.StatusOK,
+			Result: CR{"error": "", "response": "pong"},
+		},
+		{
+			Method: http.MethodGet,
+			Path:   "/accounts/panic",
+			Status: http.StatusInternalServerError,
+			Result: CR{"error": "accounts are broken"},
+		},
+		{ // context errors set the status
+			Method: http.MethodGet,
+			Path:   "/accounts/slow",
+			Status: http.StatusGatewayTimeout,
+			Result: CR{"error": "accounts db: context deadline exceeded"},
+		},
+	}
+
+	runTests(t, ts, cases)
+}
+
+func TestAccountsUse(t *testing.T) {
+	router := NewAccountsRouter(NewAccounts())
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Set("X-User", "user")
+			next.ServeHTTP(w, r)
+		})
+	})
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	runTests(t, ts, []Case{
+		{ // the middleware of the router run before the auth
+			Method: http.MethodGet,
+			Path:   "/accounts/me",
+			Status: http.StatusOK,
+			Result: CR{"error": "", "response": CR{"login": "user", "roles": nil, "scopes": nil}},
+		},
+	})
+}
+
+func TestCatalogClient(t *testing.T) {
+	ts := httptest.NewServer(NewCatalogRouter(NewCatalog()))
+	defer ts.Close()
+
+	catalog := NewCatalogClient(ts.URL)
+	catalog.Credentials = secretToken
+	ctx := context.Background()
+
+	maxQty := 5
+	created, err := catalog.Create(ctx, NewItem{
+		SKU:      "ABC-0002",
+		Name:     "pencil",
+		Price:    Money{Amount: 2},
+		Discount: &Discount{Percent: 50},
+		MaxQty:   &maxQty,
+	})
+	if err != nil {
+		t.Fatalf("create error: %v", err)
+	}
+	expected := &Item{ID: 2, SKU: "ABC-0002", Name: "pencil", Cost: 1}
+	if !reflect.DeepEqual(created, expected) {
+		t.Errorf("created item not match\nGot: %+v\nExpected: %+v", created, expected)
+	}
+
+	list, err := catalog.List(ctx, ListParams{
+		Tags:    []string{"aa", "bb"},
+		IDs:     []int{1, 2},
+		Levels:  []Level{LevelHigh},
+		Month:   time.May,
+		Timeout: 2 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("list error: %v", err)
+	}
+	if len(list.Items) != 2 || list.Params.Timeout != 2*time.Second || list.Params.Limit != 10 || list.Params.Month != time.May {
+		t.Errorf("unexpected list %+v", list)
+	}
+
+	similar, err := catalog.Similar(ctx, struct {
+		Name  string `apivalidator:"source=path"`
+		Limit int    `apivalidator:"default=5,max=10"`
+	}{Name: "a b/c", Limit: 3})
+	if err != nil {
+		t.Fatalf("similar error: %v", err)
+	}
+	if !reflect.DeepEqual(similar, []string{"a b/c", "3"}) {
+		t.Errorf("unexpected similar %v", similar)
+	}
+
+	_, err = catalog.Get(ctx, ItemID{ID: 7})
+	var apiErr ApiError
+	if !errors.As(err, &apiErr) || apiErr.HTTPStatus != http.StatusNotFound {
+		t.Errorf("expected ApiError with status 404, got %v", err)
+	}
+}
+
+func basicAuth(user, password string) string {
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.SetBasicAuth(user, password)
+
+	return strings.TrimPrefix(req.Header.Get("Authorization"), "Basic ")
+}
+
+func runTests(t *testing.T, ts *httptest.Server, cases []Case) {
+	for idx, item := range cases {
+		caseName := fmt.Sprintf("case %d: [%s] %s %s", idx, item.Method, item.Path, item.Query)
+
+		var body io.Reader
+		target := ts.URL + item.Path
+		contentType := item.ContentType
+		switch {
+		case item.Body != "":
+			body = strings.NewReader(item.Body)
+		case item.Method == http.MethodPost || item.Method == http.MethodPut:
+			body = strings.NewReader(item.Query)
+			contentType = "application/x-www-form-urlencoded"
+		case item.Query != "":
+			target += "?" + item.Query
+		}
+
+		req, err := http.NewRequest(item.Method, target, body)
+		if err != nil {
+			t.Fatalf("[%s] bad request: %v", caseName, err)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		for header, value := range item.Header {
+			req.Header.Set(header, value)
+		}
+
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Errorf("[%s] request error: %v", caseName, err)
+			continue
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != item.Status {
+			t.Errorf("[%s] expected http status %v, got %v: %s", caseName, item.Status, resp.StatusCode, data)
+			continue
+		}
+		for header, value := range item.ResponseHeader {
+			if got := resp.Header.Get(header); got != value {
+				t.Errorf("[%s] expected header %s: %q, got %q", caseName, header, value, got)
+			}
+		}
+		if item.Result == nil {
+			continue
+		}
+
+		// the expected result is converted into JSON and back to compare it with the same types
+		var result, expected interface{}
+		if err := json.Unmarshal(data, &result); err != nil {
+			t.Errorf("[%s] cant unpack json: %v", caseName, err)
+			continue
+		}
+		expectedJSON, _ := json.Marshal(item.Result)
+		json.Unmarshal(expectedJSON, &expected)
+
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("[%s] results not match\nGot: %s\nExpected: %s", caseName, data, expectedJSON)
+		}
+	}
+}
@@ -0,0 +1,640 @@
+package main
+
+import (
+	"fmt"
+	"go/types"
+	"math/big"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+var (
+	testFuncTpl = template.Must(template.New("testFuncTpl").Parse(`
+func TestGenerated{{.StructName}}{{.MethodName}}(t *testing.T) {
+	{{- if .Source}}
+	t.Setenv("{{.Param}}", "{{.Value}}")
+	authorize := func(r *http.Request) {
+		{{.Source}}
+	}
+
+	runGeneratedCases(t, New{{.StructName}}Router({{.Type}}), authorize, []generatedCase{
+	{{- else}}
+	runGeneratedCases(t, New{{.StructName}}Router({{.Type}}), nil, []generatedCase{
+	{{- end}}`))
+
+	testCaseTpl = template.Must(template.New("testCaseTpl").Parse(`
+		{
+			Name:   {{printf "%q" .Name}},
+			Method: {{printf "%q" .Method}},
+			Path:   {{printf "%q" .Path}},
+			{{- with .Params}}
+			Params: {{printf "%q" .Encode}},
+			{{- end}}
+			{{- if .Auth}}
+			Auth:   true,
+			{{- end}}
+			{{- with .Status}}
+			Status: {{index $.StatusNames .}},
+			{{- end}}
+			Error:  {{printf "%q" .Error}},
+		},`))
+
+	testHelpersTpl = template.Must(template.New("testHelpersTpl").Parse(`
+// generatedCase is a request breaking or passing a rule of the endpoint
+type generatedCase struct {
+	Name   string
+	Method string
+	Path   string
+	// Params are sent in the form body if the method has one or in the query otherwise
+	Params string
+	Auth   bool
+	// Status and Error are the expected reply, if Status is 0
+	// the request must not fail with Error
+	Status int
+	Error  string
+}
+
+// runGeneratedCases sends the requests of the cases to the handler,
+// authorize adds the credentials to the requests of the cases with Auth
+func runGeneratedCases(t *testing.T, handler http.Handler, authorize func(r *http.Request), cases []generatedCase) {
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	for _, item := range cases {
+		t.Run(item.Name, func(t *testing.T) {
+			var body io.Reader
+			target := ts.URL + item.Path
+			switch item.Method {
+			case http.MethodPost, http.MethodPut, http.MethodPatch:
+				body = strings.NewReader(item.Params)
+			default:
+				target += "?" + item.Params
+			}
+
+			req, err := http.NewRequest(item.Method, target, body)
+			if err != nil {
+				t.Fatalf("bad request: %v", err)
+			}
+			if body != nil {
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			if item.Auth {
+				authorize(req)
+			}
+
+			resp, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatalf("request error: %v", err)
+			}
+			defer resp.Body.Close()
+
+			// the error is replied in error or, by problem details, in detail,
+			// errors of all params are replied in errors
+			var reply struct {
+				Error  string ` + "`" + `json:"error"` + "`" + `
+				Detail string ` + "`" + `json:"detail"` + "`" + `
+				Errors []struct {
+					Message string ` + "`" + `json:"message"` + "`" + `
+				} ` + "`" + `json:"errors"` + "`" + `
+			}
+			json.NewDecoder(resp.Body).Decode(&reply)
+
+			messages := []string{reply.Error, reply.Detail}
+			for _, fieldErr := range reply.Errors {
+				messages = append(messages, fieldErr.Message)
+			}
+			failed := false
+			for _, message := range messages {
+				failed = failed || message == item.Error
+			}
+
+			if item.Status == 0 {
+				if failed {
+					t.Errorf("unexpected error %q", item.Error)
+				}
+				return
+			}
+			if resp.StatusCode != item.Status {
+				t.Errorf("expected http status %v, got %v", item.Status, resp.StatusCode)
+			}
+			if !failed {
+				t.Errorf("expected error %q, got %q", item.Error, messages)
+			}
+		})
+	}
+}
+`))
+)
+
+// testSecret is the credential the generated tests authenticate with
+const testSecret = "test-secret"
+
+// testCase is a request to the endpoint with the expected reply,
+// if Status is 0 the request must not fail with Error
+type testCase struct {
+	Name   string
+	Method string
+	Path   string
+	Params url.Values
+	Auth   bool
+	Status int
+	Error  string
+}
+
+var statusNames = map[int]string{
+	http.StatusBadRequest:       "http.StatusBadRequest",
+	http.StatusUnauthorized:     "http.StatusUnauthorized",
+	http.StatusMethodNotAllowed: "http.StatusMethodNotAllowed",
+}
+
+// serviceTests writes a test per endpoint of the service sending
+// requests which break or barely pass the rules of the endpoint
+func (g *generator) serviceTests(srv *service) {
+	for _, ep := range srv.Endpoints {
+		cases := testCases(srv, ep)
+		if cases == nil {
+			continue
+		}
+
+		g.use("net/http")
+		g.use("testing")
+		auth := tpl{}
+		if spec := ep.Spec.Auth; spec != nil {
+			auth = testAuth(spec)
+		}
+		auth.StructName = srv.Name
+		auth.MethodName = ep.Name
+		auth.Type = g.testService(srv)
+		testFuncTpl.Execute(&g.out, auth)
+
+		for _, c := range cases {
+			testCaseTpl.Execute(&g.out, struct {
+				testCase
+				StatusNames map[int]string
+			}{c, statusNames})
+		}
+		fmt.Fprintln(&g.out, "\n	})\n}")
+	}
+}
+
+// testHelpers writes the runner of the cases
+func (g *generator) testHelpers() {
+	g.use("encoding/json")
+	g.use("io")
+	g.use("net/http")
+	g.use("net/http/httptest")
+	g.use("strings")
+	g.use("testing")
+	testHelpersTpl.Execute(&g.out, tpl{})
+}
+
+// testService returns the expression of the service tested,
+// it is made by New<Service>() if the package has such func
+func (g *generator) testService(srv *service) string {
+	if fn, ok := g.pkg.Scope().Lookup("New" + srv.Name).(*types.Func); ok {
+		sig := fn.Type().(*types.Signature)
+		if sig.Params().Len() == 0 && sig.Results().Len() == 1 && types.Identical(sig.Results().At(0).Type(), types.NewPointer(srv.Type)) {
+			return "New" + srv.Name + "()"
+		}
+	}
+
+	return "&" + srv.Name + "{}"
+}
+
+// testAuth returns the env variable with the credential
+// and the statement sending it in the request
+func testAuth(auth *authSpec) tpl {
+	t := tpl{Param: auth.Env, Value: testSecret}
+
+	switch auth.Type {
+	case "token", "apikey":
+		if auth.Query != "" {
+			t.Source = fmt.Sprintf("query := r.URL.Query()\n\t\tquery.Set(%q, %q)\n\t\tr.URL.RawQuery = query.Encode()", auth.Query, testSecret)
+		} else {
+			t.Source = fmt.Sprintf("r.Header.Set(%q, %q)", auth.Header, testSecret)
+		}
+	case "bearer":
+		t.Source = fmt.Sprintf("r.Header.Set(\"Authorization\", %q)", "Bearer "+testSecret)
+	case "basic":
+		t.Value = "user:" + testSecret
+		t.Source = fmt.Sprintf("r.SetBasicAuth(\"user\", %q)", testSecret)
+	}
+
+	return t
+}
+
+// testCases returns the cases of the endpoint: a method no endpoint of its url
+// accepts, a request without credentials and, if the rest of the params can be
+// made up, params missing, out of their bounds, of a wrong type or not in their enum.
+// Endpoints authenticated by the service can't be tested as there
+// are no credentials to send.
+func testCases(srv *service, ep *endpoint) []testCase {
+	if ep.Spec.Auth != nil && ep.Spec.Auth.Type == "method" {
+		return nil
+	}
+	path, ok := testPath(ep)
+	if !ok {
+		return nil
+	}
+
+	base := testCase{
+		Method: http.MethodPost,
+		Path:   path,
+		Auth:   ep.Spec.Auth != nil,
+	}
+	if len(ep.Spec.Methods) != 0 {
+		base.Method = ep.Spec.Methods[0]
+	}
+
+	var cases []testCase
+	if allowed := srv.urlMethods(ep.Spec.URL); len(allowed) != 0 {
+		for _, method := range httpMethods {
+			if !contains(allowed, method) && method != http.MethodHead {
+				c := base
+				c.Name, c.Method, c.Status, c.Error = "wrong method", method, http.StatusMethodNotAllowed, "bad method"
+				cases = append(cases, c)
+				break
+			}
+		}
+	}
+	if base.Auth {
+		c := base
+		c.Name, c.Auth, c.Status, c.Error = "missing auth", false, http.StatusUnauthorized, "unauthorized"
+		cases = append(cases, c)
+	}
+
+	// params are checked only after the principal is authorized
+	if ep.Spec.Roles == nil && ep.Spec.Scopes == nil {
+		cases = append(cases, paramCases(ep, base)...)
+	}
+
+	return cases
+}
+
+// testPath returns the path of the endpoint with the placeholders filled,
+// it is not ok if the values made up don't match the route
+func testPath(ep *endpoint) (string, bool) {
+	if ep.Route == nil {
+		return ep.Spec.URL, true
+	}
+
+	path := ep.Route.Path
+	for _, rp := range ep.Route.Params {
+		value := "a"
+		for _, f := range ep.Params.Fields {
+			if f.Rules.Source == "path" && f.Param == rp.Name {
+				var ok bool
+				if value, ok = testValue(f); !ok {
+					return "", false
+				}
+			}
+		}
+		path = strings.Replace(path, "{"+rp.Name+"}", url.PathEscape(value), 1)
+	}
+
+	matched, err := regexp.MatchString(ep.Route.Pattern, path)
+
+	return path, err == nil && matched
+}
+
+// paramCases returns the cases of every param sent with the valid values
+// of the rest of params, there are none if a required param can't be made up
+// or params depend on each other
+func paramCases(ep *endpoint, base testCase) []testCase {
+	if hasCrossRules(ep.Params.Fields) {
+		return nil
+	}
+
+	fields := flattenFields(ep.Params.Fields, false)
+	valid := url.Values{}
+	for _, f := range fields {
+		values, ok := testValues(f.field)
+		for i := range values {
+			values[i] = testParam(f.field, values[i])
+		}
+		switch {
+		case ok:
+			valid[f.field.Param] = values
+		case f.field.Rules.Required || zeroFails(f.field):
+			return nil
+		}
+	}
+
+	var cases []testCase
+	for _, ff := range fields {
+		f := ff.field
+		sent, ok := valid[f.Param]
+		if !ok {
+			continue
+		}
+		r := f.Rules
+
+		add := func(name string, value *string, status int, message string) {
+			// zero values are replaced with the default
+			if value != nil && f.Default != nil && literal(f.Kind, *value) == zeroValue(f.Kind) {
+				return
+			}
+
+			c := base
+			c.Name = f.Param + " " + name
+			c.Params = url.Values{}
+			for param, values := range valid {
+				c.Params[param] = values
+			}
+			delete(c.Params, f.Param)
+			if value != nil {
+				for range sent {
+					c.Params.Add(f.Param, testParam(f, *value))
+				}
+			}
+			c.Status = status
+			c.Error = message
+			cases = append(cases, c)
+		}
+		fail := func(name, value, message string) {
+			add(name, &value, http.StatusBadRequest, message)
+		}
+		pass := func(name, value, message string) {
+			add(name, &value, 0, message)
+		}
+
+		// a pointer struct without the only param sent is left nil
+		if ff.required && (!inPtrStruct(ep.Params.Fields, f) || testSiblings(valid, f.Param)) {
+			add("required", nil, http.StatusBadRequest, f.Param+" must me not empty")
+		}
+
+		// zero values of required params fail the required rule first
+		required := r.Required || f.Slice
+		switch f.Kind {
+		case "string":
+			if r.Min != "" {
+				min, _ := strconv.Atoi(r.Min)
+				if min > 1 || min == 1 && !required {
+					fail("min-1", strings.Repeat("a", min-1), f.Param+" len must be >= "+r.Min)
+				}
+				if min > 0 || !required {
+					pass("min", strings.Repeat("a", min), f.Param+" len must be >= "+r.Min)
+				}
+			}
+			if r.Max != "" {
+				max, _ := strconv.Atoi(r.Max)
+				if max > 0 || !required {
+					pass("max", strings.Repeat("a", max), f.Param+" len must be <= "+r.Max)
+				}
+				fail("max+1", strings.Repeat("a", max+1), f.Param+" len must be <= "+r.Max)
+			}
+			if r.Format != "" && testLen(r) > 0 {
+				fail("format", strings.Repeat("x", testLen(r)), f.Param+" must be a valid "+r.Format)
+			}
+		case "bool":
+			fail("type", "abc", f.Param+" must be bool")
+		default:
+			isZero := func(value string) bool {
+				return required && literal(f.Kind, value) == zeroValue(f.Kind)
+			}
+			if r.Min != "" {
+				if value, ok := shiftNumber(f.Kind, r.Min, -1); ok && !isZero(value) {
+					fail("min-1", value, f.Param+" must be >= "+r.Min)
+				}
+				pass("min", r.Min, f.Param+" must be >= "+r.Min)
+			}
+			if r.Max != "" {
+				pass("max", r.Max, f.Param+" must be <= "+r.Max)
+				if value, ok := shiftNumber(f.Kind, r.Max, 1); ok && !isZero(value) {
+					fail("max+1", value, f.Param+" must be <= "+r.Max)
+				}
+			}
+			message := f.Param + " must be " + f.Kind
+			if isDurationField(f) {
+				message = f.Param + " must be a duration"
+			}
+			fail("type", "abc", message)
+		}
+
+		if len(r.Enum) != 0 && r.Format == "" {
+			if value, ok := testNotInEnum(f); ok {
+				fail("enum", value, f.Param+" must be one of ["+strings.Join(r.Enum, ", ")+"]")
+			}
+		}
+	}
+
+	return cases
+}
+
+// zeroFails reports whether the zero value the field is left with
+// if its param is not sent is out of its bounds
+func zeroFails(f *field) bool {
+	r := f.Rules
+	if f.Ptr || f.Slice || f.Default != nil {
+		return false
+	}
+
+	switch f.Kind {
+	case "string":
+		min, _ := strconv.Atoi(r.Min)
+		return min > 0
+	case "bool":
+		return false
+	}
+
+	return r.Min != "" && compareNumbers("0", r.Min) < 0 || r.Max != "" && compareNumbers("0", r.Max) > 0
+}
+
+// inPtrStruct reports whether the field is nested in a pointer struct
+func inPtrStruct(fields []*field, target *field) bool {
+	for _, f := range fields {
+		if f.Fields != nil && strings.HasPrefix(target.Param, f.Param+".") {
+			return f.Ptr || inPtrStruct(f.Fields, target)
+		}
+	}
+
+	return false
+}
+
+// testSiblings reports whether other params of the struct of the param are sent
+func testSiblings(valid url.Values, param string) bool {
+	prefix := param[:strings.LastIndex(param, ".")+1]
+	for other := range valid {
+		if other != param && strings.HasPrefix(other, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasCrossRules(fields []*field) bool {
+	for _, f := range fields {
+		if f.RequiredIf != nil || f.RequiredWithout != nil || f.EqField != nil || f.GtField != nil {
+			return true
+		}
+		if hasCrossRules(f.Fields) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// testValues returns the valid values of the param, for slices there
+// are as many items as they must contain at least
+func testValues(f *field) ([]string, bool) {
+	value, ok := testValue(f)
+	if !ok {
+		return nil, false
+	}
+
+	n := 1
+	if f.Rules.MinItems != "" {
+		n, _ = strconv.Atoi(f.Rules.MinItems)
+	}
+	if n > 1 && f.Rules.Unique {
+		return nil, false
+	}
+	values := []string{value}
+	for len(values) < n {
+		values = append(values, value)
+	}
+
+	return values, true
+}
+
+// testValue returns a valid value of the field, it can't be made up
+// for fields with pattern or validate rules
+func testValue(f *field) (string, bool) {
+	r := f.Rules
+	if r.Pattern != "" || f.Validator != nil {
+		return "", false
+	}
+	if len(r.Enum) != 0 {
+		return r.Enum[0], true
+	}
+
+	switch f.Kind {
+	case "string":
+		if r.Format != "" {
+			return formatHelpers[r.Format].Sample, true
+		}
+		return strings.Repeat("a", testLen(r)), true
+	case "bool":
+		return "true", true
+	}
+
+	if r.Min != "" {
+		return r.Min, true
+	}
+	if max, err := strconv.ParseFloat(r.Max, 64); err == nil && max < 1 {
+		return r.Max, true
+	}
+
+	return "1", true
+}
+
+// testParam returns the value as it is sent in the param of the field,
+// durations are sent in nanoseconds as they are parsed with a unit
+func testParam(f *field, value string) string {
+	if isDurationField(f) && checkValue(f.Kind, value) == nil {
+		return value + "ns"
+	}
+
+	return value
+}
+
+// testLen returns the length of valid strings
+func testLen(r *rules) int {
+	n := 1
+	if r.Min != "" {
+		n, _ = strconv.Atoi(r.Min)
+	}
+	if max, err := strconv.Atoi(r.Max); err == nil && max < n {
+		n = max
+	}
+
+	return n
+}
+
+// testNotInEnum returns a value which is not in the enum of the field
+// but fits the rest of its rules
+func testNotInEnum(f *field) (string, bool) {
+	r := f.Rules
+
+	if f.Kind == "string" {
+		// the length is kept so the value fits min and max
+		first := r.Enum[0]
+		if first == "" {
+			first = "a"
+		}
+		for _, last := range "xyzw" {
+			value := first[:len(first)-1] + string(last)
+			if !contains(r.Enum, value) {
+				return value, true
+			}
+		}
+		return "", false
+	}
+
+	start := "1"
+	if r.Min != "" {
+		start = r.Min
+	}
+	for i := int64(0); i < 100; i++ {
+		value, ok := shiftNumber(f.Kind, start, i)
+		if !ok || r.Max != "" && compareNumbers(value, r.Max) > 0 {
+			break
+		}
+		if literal(f.Kind, value) != zeroValue(f.Kind) && !containsLiteral(f.Kind, r.Enum, value) {
+			return value, true
+		}
+	}
+
+	return "", false
+}
+
+// shiftNumber adds delta to the number of the kind,
+// it is not ok if the sum is out of the range of the kind
+func shiftNumber(kind, value string, delta int64) (string, bool) {
+	info := kinds[kind]
+	bits := info.Bits
+	if bits == 0 {
+		bits = 64
+	}
+
+	switch info.Parser {
+	case "ParseInt", "ParseUint":
+		n, ok := new(big.Int).SetString(value, 10)
+		if !ok {
+			return "", false
+		}
+		n.Add(n, big.NewInt(delta))
+
+		var err error
+		if info.Parser == "ParseInt" {
+			_, err = strconv.ParseInt(n.String(), 10, bits)
+		} else {
+			_, err = strconv.ParseUint(n.String(), 10, bits)
+		}
+		return n.String(), err == nil
+	case "ParseFloat":
+		n, err := strconv.ParseFloat(value, bits)
+		if err != nil || n+float64(delta) == n && delta != 0 {
+			return "", false
+		}
+		return strconv.FormatFloat(n+float64(delta), 'g', -1, bits), true
+	}
+
+	return "", false
+}
+
+func compareNumbers(a, b string) int {
+	x, _ := new(big.Float).SetString(a)
+	y, _ := new(big.Float).SetString(b)
+	if x == nil || y == nil {
+		return 0
+	}
+
+	return x.Cmp(y)
+}
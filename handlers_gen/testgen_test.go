@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestShiftNumber(t *testing.T) {
+	cases := []struct {
+		Kind     string
+		Value    string
+		Delta    int64
+		Expected string
+		Ok       bool
+	}{
+		{"int", "0", -1, "-1", true},
+		{"int8", "-128", -1, "", false},
+		{"uint", "0", -1, "", false},
+		{"uint8", "254", 1, "255", true},
+		{"float32", "0.5", -1, "-0.5", true},
+		{"int", "abc", 1, "", false},
+	}
+
+	for _, item := range cases {
+		got, ok := shiftNumber(item.Kind, item.Value, item.Delta)
+		if ok != item.Ok || ok && got != item.Expected {
+			t.Errorf("[%s %s%+d] expected %q %v, got %q %v", item.Kind, item.Value, item.Delta, item.Expected, item.Ok, got, ok)
+		}
+	}
+}
+
+func TestNotInEnum(t *testing.T) {
+	cases := []struct {
+		Field    *field
+		Expected string
+	}{
+		{&field{Kind: "string", Rules: &rules{Enum: []string{"user", "usex"}}}, "usey"},
+		{&field{Kind: "int", Rules: &rules{Enum: []string{"1", "2"}}}, "3"},
+		{&field{Kind: "int", Rules: &rules{Enum: []string{"-1", "1"}, Min: "-1"}}, "2"},
+	}
+
+	for _, item := range cases {
+		if got, _ := testNotInEnum(item.Field); got != item.Expected {
+			t.Errorf("[%v] expected %q, got %q", item.Field.Rules.Enum, item.Expected, got)
+		}
+	}
+}
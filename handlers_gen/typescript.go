@@ -0,0 +1,613 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"go/types"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+var (
+	tsHeaderTpl = template.Must(template.New("tsHeaderTpl").Parse(`// Code generated by handlers_gen; DO NOT EDIT.
+
+export interface ApiError {
+  // status is the HTTP status of the response, 0 if there is no response
+  status: number;
+  message: string;
+  // errors are the errors of all params if the endpoint collects them
+  errors?: FieldError[];
+}
+
+export interface FieldError {
+  field: string;
+  rule: string;
+  message: string;
+}
+
+export type Result<T> = { ok: true; value: T } | { ok: false; error: ApiError };
+
+export interface ClientOptions {
+  // credentials are sent to the endpoints requiring auth the way their strategy
+  // expects them: the token, the API key or user:password of basic auth
+  credentials?: string;
+  // headers are sent with every request, e.g. with the credentials of method auth
+  headers?: Record<string, string>;
+  // fetch sends the requests, the global fetch is used by default
+  fetch?: typeof fetch;
+}
+`))
+
+	tsClientTpl = template.Must(template.New("tsClientTpl").Parse(`
+// {{.StructName}}Client calls the endpoints of {{.StructName}},
+// params are sent in the form like they are named in the apivalidator tags
+export class {{.StructName}}Client {
+  constructor(readonly baseURL: string, readonly options: ClientOptions = {}) {}
+`))
+
+	tsMethodTpl = template.Must(template.New("tsMethodTpl").Parse(`
+  // {{.MethodName}} calls {{.StructName}}.{{.MethodName}}
+  {{.FieldName}}(params: {{.Type}}{{.Path}}): Promise<Result<{{.Conv}}>> {
+    const form = new URLSearchParams();
+`))
+
+	tsCallTpl = template.Must(template.New("tsCallTpl").Parse(`    return call<{{.Conv}}>(this, "{{.Kind}}", {{.Path}}, form{{if .Source}}, {{.Source}}{{end}});
+  }
+`))
+
+	tsHelpersTpl = template.Must(template.New("tsHelpersTpl").Parse(`
+// Auth is where the credentials are sent
+interface Auth {
+  header?: string;
+  query?: string;
+  scheme?: string;
+}
+
+function appendParam(form: URLSearchParams, name: string, value: unknown): void {
+  if (value === undefined || value === null) {
+    return;
+  }
+  if (Array.isArray(value)) {
+    for (const item of value) {
+      form.append(name, String(item));
+    }
+    return;
+  }
+  form.append(name, String(value));
+}
+
+// call sends the params in the form body if the method has a body
+// or in the query otherwise and decodes the result or the error
+async function call<T>(
+  client: { baseURL: string; options: ClientOptions },
+  method: string,
+  path: string,
+  form: URLSearchParams,
+  auth?: Auth,
+): Promise<Result<T>> {
+  const { options } = client;
+  const headers: Record<string, string> = { ...options.headers };
+  const hasBody = method === "POST" || method === "PUT" || method === "PATCH";
+  const query = new URLSearchParams(hasBody ? undefined : form);
+
+  const credentials = options.credentials;
+  if (auth && credentials !== undefined) {
+    if (auth.query) {
+      query.set(auth.query, credentials);
+    } else if (auth.scheme === "Basic") {
+      headers["Authorization"] = "Basic " + btoa(credentials);
+    } else if (auth.scheme) {
+      headers["Authorization"] = auth.scheme + " " + credentials;
+    } else if (auth.header) {
+      headers[auth.header] = credentials;
+    }
+  }
+
+  let url = client.baseURL + path;
+  if (query.toString() !== "") {
+    url += "?" + query.toString();
+  }
+
+  let response: Response;
+  let body: any;
+  try {
+    response = await (options.fetch ?? fetch)(url, { method, headers, body: hasBody ? form : undefined });
+    body = await response.json().catch(() => ({}));
+  } catch (err) {
+    return { ok: false, error: { status: 0, message: String(err) } };
+  }
+{{- if eq .Kind "problem"}}
+
+  if (!response.ok) {
+    return {
+      ok: false,
+      error: {
+        status: response.status,
+        message: body?.detail || body?.title || response.statusText,
+        errors: body?.errors,
+      },
+    };
+  }
+
+  return { ok: true, value: body as T };
+{{- else}}
+
+  if (!response.ok || body?.error) {
+    return {
+      ok: false,
+      error: {
+        status: response.status,
+        message: body?.error || response.statusText,
+        errors: body?.errors,
+      },
+    };
+  }
+
+  return { ok: true, value: body?.response as T };
+{{- end}}
+}
+`))
+)
+
+// typeScript writes the TypeScript client of the services: interfaces
+// of params and results and a class calling the endpoints per service
+type typeScript struct {
+	opts options
+	pkg  *types.Package
+	// decls are the declarations of types in the order they are met
+	decls bytes.Buffer
+	names structNames
+	taken map[string]bool
+}
+
+func newTypeScript(opts options, pkg *types.Package) *typeScript {
+	ts := &typeScript{
+		opts:  opts,
+		pkg:   pkg,
+		names: make(structNames),
+		taken: make(map[string]bool),
+	}
+	for _, name := range []string{"ApiError", "FieldError", "Result", "ClientOptions", "Auth", "Response"} {
+		ts.taken[name] = true
+	}
+
+	return ts
+}
+
+// source returns the code of the TypeScript module
+func (ts *typeScript) source(services []*service) []byte {
+	for _, srv := range services {
+		ts.taken[srv.Name+"Client"] = true
+	}
+
+	var classes bytes.Buffer
+	for _, srv := range services {
+		tsClientTpl.Execute(&classes, tpl{
+			StructName: srv.Name,
+		})
+		for _, ep := range srv.Endpoints {
+			ts.method(&classes, srv, ep)
+		}
+		fmt.Fprintln(&classes, "}")
+	}
+
+	var src bytes.Buffer
+	tsHeaderTpl.Execute(&src, tpl{})
+	src.Write(ts.decls.Bytes())
+	src.Write(classes.Bytes())
+	tsHelpersTpl.Execute(&src, tpl{
+		Kind: ts.opts.Envelope,
+	})
+
+	return src.Bytes()
+}
+
+// declare returns the free name for the type, types of other packages
+// are prefixed with the package name if the name is taken
+func (ts *typeScript) declare(name string, pkg *types.Package) string {
+	if ts.taken[name] && pkg != nil && pkg != ts.pkg {
+		name = exportedName(pkg.Name()) + name
+	}
+	base := name
+	for i := 2; ts.taken[name]; i++ {
+		name = base + strconv.Itoa(i)
+	}
+	ts.taken[name] = true
+
+	return name
+}
+
+// method writes the method calling the endpoint, placeholders
+// of the url not filled from the params are passed after the params
+func (ts *typeScript) method(out *bytes.Buffer, srv *service, ep *endpoint) {
+	paramsType := ts.paramsInterface(srv, ep)
+	result := ts.tsType(ep.Result)
+
+	path := strconv.Quote(ep.Spec.URL)
+	var args string
+	if ep.Route != nil {
+		var placeholders []string
+		path, placeholders = ts.path(ep)
+		for _, arg := range placeholders {
+			args += ", " + arg + ": string"
+		}
+	}
+
+	tsMethodTpl.Execute(out, tpl{
+		StructName: srv.Name,
+		MethodName: ep.Name,
+		FieldName:  tsMethodName(ep.Name),
+		Type:       paramsType,
+		Path:       args,
+		Conv:       result,
+	})
+	for _, f := range flattenFields(ep.Params.Fields, false) {
+		fmt.Fprintf(out, "    appendParam(form, %q, %s);\n", f.field.Param, ts.paramValue(ep.Params.Fields, f.field))
+	}
+
+	method := http.MethodPost
+	if len(ep.Spec.Methods) != 0 {
+		method = ep.Spec.Methods[0]
+	}
+	tsCallTpl.Execute(out, tpl{
+		Kind:   method,
+		Path:   path,
+		Conv:   result,
+		Source: tsAuth(ep.Spec.Auth),
+	})
+}
+
+// tsAuth returns the literal of Auth of the strategy,
+// method auth is up to the service so it has none
+func tsAuth(auth *authSpec) string {
+	if auth == nil {
+		return ""
+	}
+
+	switch auth.Type {
+	case "token", "apikey":
+		if auth.Query != "" {
+			return fmt.Sprintf("{ query: %q }", auth.Query)
+		}
+		return fmt.Sprintf("{ header: %q }", auth.Header)
+	case "bearer":
+		return `{ scheme: "Bearer" }`
+	case "basic":
+		return `{ scheme: "Basic" }`
+	}
+
+	return ""
+}
+
+// path returns the template literal of the url of the endpoint with the
+// placeholders filled and the args of the placeholders without fields
+func (ts *typeScript) path(ep *endpoint) (string, []string) {
+	var parts, args []string
+	for _, part := range pathParts(ep) {
+		parts = append(parts, tsTemplateText(part.Text))
+		if part.Param == "" {
+			continue
+		}
+
+		var value string
+		if part.Field != nil {
+			value = "String(" + tsAccess("params", part.Field.Param) + ")"
+		} else {
+			value = tsArgName(part.Param)
+			args = append(args, value)
+		}
+		parts = append(parts, "${encodeURIComponent("+value+")}")
+	}
+
+	return "`" + strings.Join(parts, "") + "`", args
+}
+
+func tsTemplateText(text string) string {
+	r := strings.NewReplacer("\\", "\\\\", "`", "\\`", "${", "\\${")
+	return r.Replace(text)
+}
+
+// paramValue returns the expression of the value of the form field,
+// nested structs which may be missing are accessed with optional chaining
+func (ts *typeScript) paramValue(fields []*field, target *field) string {
+	value := "params"
+	prefix := ""
+	for {
+		var nested *field
+		for _, f := range fields {
+			if f == target {
+				return tsAccess(value, strings.TrimPrefix(f.Param, prefix))
+			}
+			if f.Fields != nil && strings.HasPrefix(target.Param, f.Param+".") {
+				nested = f
+			}
+		}
+		if nested == nil {
+			return value
+		}
+
+		value = tsAccess(value, strings.TrimPrefix(nested.Param, prefix))
+		if !ts.nestedRequired(nested) {
+			value += "?"
+		}
+		prefix = nested.Param + "."
+		fields = nested.Fields
+	}
+}
+
+// paramsInterface declares the interface of the params sent in the form
+// and returns its name, params of nested structs are nested objects
+func (ts *typeScript) paramsInterface(srv *service, ep *endpoint) string {
+	name := srv.Name + ep.Name + "Params"
+	var pkg *types.Package
+	if named, ok := types.Unalias(ep.Params.Type).(*types.Named); ok {
+		name, pkg = named.Obj().Name(), named.Obj().Pkg()
+	}
+	name = ts.declare(name, pkg)
+
+	var body bytes.Buffer
+	ts.paramsObject(&body, ep.Params.Fields, "", 1)
+	fmt.Fprintf(&ts.decls, "\nexport interface %s {\n%s}\n", name, body.String())
+
+	return name
+}
+
+// paramsObject writes the properties of the fields
+// named by their params with the prefix trimmed
+func (ts *typeScript) paramsObject(out *bytes.Buffer, fields []*field, prefix string, depth int) {
+	indent := strings.Repeat("  ", depth)
+	for _, f := range fields {
+		name := tsProperty(strings.TrimPrefix(f.Param, prefix))
+
+		if f.Fields != nil {
+			optional := "?"
+			if ts.nestedRequired(f) {
+				optional = ""
+			}
+			fmt.Fprintf(out, "%s%s%s: {\n", indent, name, optional)
+			ts.paramsObject(out, f.Fields, f.Param+".", depth+1)
+			fmt.Fprintf(out, "%s};\n", indent)
+			continue
+		}
+
+		optional := "?"
+		if f.Rules.Source == "path" || f.Rules.Required && f.Default == nil {
+			optional = ""
+		}
+		fmt.Fprintf(out, "%s%s%s: %s;\n", indent, name, optional, ts.fieldType(f))
+	}
+}
+
+// nestedRequired reports if the object of the nested struct must be passed,
+// it is if the struct is required or has required fields and is not a pointer
+func (ts *typeScript) nestedRequired(f *field) bool {
+	if f.Rules.Required {
+		return true
+	}
+	if f.Ptr {
+		return false
+	}
+	for _, child := range flattenFields(f.Fields, false) {
+		if child.required {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fieldType returns the type of the values of the field,
+// values of enum fields are unions of their literals
+func (ts *typeScript) fieldType(f *field) string {
+	t := tsBasic(f.Kind)
+	if isDurationField(f) {
+		// durations are sent like 1m30s
+		t = "string"
+	}
+	if len(f.Rules.Enum) != 0 {
+		var values []string
+		for _, value := range f.Rules.Enum {
+			values = append(values, literal(f.Kind, value))
+		}
+		t = strings.Join(values, " | ")
+	}
+
+	if f.Slice {
+		return tsArray(t)
+	}
+
+	return t
+}
+
+// tsBasic returns the type of the values of the supported kind
+func tsBasic(kind string) string {
+	switch kind {
+	case "string":
+		return "string"
+	case "bool":
+		return "boolean"
+	case "":
+		return "unknown"
+	}
+
+	return "number"
+}
+
+func tsArray(t string) string {
+	if strings.Contains(t, " ") {
+		return "(" + t + ")[]"
+	}
+
+	return t + "[]"
+}
+
+// tsType returns the type of the values of the Go type as encoding/json
+// writes them, named structs are declared as interfaces once
+func (ts *typeScript) tsType(t types.Type) string {
+	switch t := types.Unalias(t).(type) {
+	case *types.Named:
+		if s := ts.namedType(t); s != "" {
+			return s
+		}
+		if st, ok := t.Underlying().(*types.Struct); ok && t.TypeArgs().Len() == 0 {
+			return ts.structInterface(t, st)
+		}
+		return ts.tsType(t.Underlying())
+	case *types.Pointer:
+		return ts.tsType(t.Elem())
+	case *types.Basic:
+		return tsBasic(basicName(t))
+	case *types.Slice:
+		if basic, ok := types.Unalias(t.Elem()).(*types.Basic); ok && basic.Kind() == types.Byte {
+			return "string"
+		}
+		return tsArray(ts.tsType(t.Elem()))
+	case *types.Array:
+		return tsArray(ts.tsType(t.Elem()))
+	case *types.Map:
+		return "Record<string, " + ts.tsType(t.Elem()) + ">"
+	case *types.Struct:
+		var body bytes.Buffer
+		ts.properties(&body, t, 1)
+		if body.Len() == 0 {
+			return "{}"
+		}
+		return "{ " + strings.TrimSuffix(strings.ReplaceAll(strings.TrimSpace(body.String()), "\n  ", " "), ";") + " }"
+	}
+
+	return "unknown"
+}
+
+// namedType returns the type of the named types encoding/json writes in their own way
+func (ts *typeScript) namedType(t *types.Named) string {
+	switch jsonEncoding(t) {
+	case jsonTime, jsonText:
+		return "string"
+	case jsonMarshaler:
+		return "unknown"
+	}
+
+	return ""
+}
+
+// structInterface declares the interface of the named struct and returns its name
+func (ts *typeScript) structInterface(t *types.Named, st *types.Struct) string {
+	take := func() string {
+		return ts.declare(t.Obj().Name(), t.Obj().Pkg())
+	}
+
+	return ts.names.name(t, take, func(name string) {
+		var body bytes.Buffer
+		ts.properties(&body, st, 1)
+		fmt.Fprintf(&ts.decls, "\nexport interface %s {\n%s}\n", name, body.String())
+	})
+}
+
+// properties writes the fields of the struct as encoding/json writes them,
+// fields with omitempty are optional
+func (ts *typeScript) properties(out *bytes.Buffer, st *types.Struct, depth int) {
+	indent := strings.Repeat("  ", depth)
+	for _, jf := range jsonFields(st, "") {
+		t := ts.tsType(jf.Var.Type())
+		if jf.String {
+			t = "string"
+		}
+		optional := ""
+		if jf.OmitEmpty {
+			optional = "?"
+		}
+		fmt.Fprintf(out, "%s%s%s: %s;\n", indent, tsProperty(jf.Key), optional, t)
+	}
+}
+
+// tsReserved are the words which can't be names of args
+var tsReserved = []string{
+	"break", "case", "catch", "class", "const", "continue", "debugger", "default",
+	"delete", "do", "else", "enum", "export", "extends", "false", "finally", "for",
+	"function", "if", "import", "in", "instanceof", "new", "null", "return", "super",
+	"switch", "this", "throw", "true", "try", "typeof", "var", "void", "while", "with",
+	"yield", "let", "static", "implements", "interface", "package", "private",
+	"protected", "public", "await", "params", "form",
+}
+
+func isTSIdent(name string) bool {
+	for i, r := range name {
+		if !(r == '_' || r == '$' || unicode.IsLetter(r) || i > 0 && unicode.IsDigit(r)) {
+			return false
+		}
+	}
+
+	return name != ""
+}
+
+// tsProperty returns the name of the property, quoted if it is not an identifier
+func tsProperty(name string) string {
+	if isTSIdent(name) {
+		return name
+	}
+
+	return strconv.Quote(name)
+}
+
+// tsAccess returns the expression of the property of the value,
+// the value ending with ? is accessed with optional chaining
+func tsAccess(value, name string) string {
+	if isTSIdent(name) {
+		return value + "." + name
+	}
+	if strings.HasSuffix(value, "?") {
+		return value + ".[" + strconv.Quote(name) + "]"
+	}
+
+	return value + "[" + strconv.Quote(name) + "]"
+}
+
+// tsArgName turns the name of a placeholder into an identifier
+func tsArgName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, name)
+	if !isTSIdent(name) || contains(tsReserved, name) {
+		name = "_" + name
+	}
+
+	return name
+}
+
+// tsMethodName is the Go method name starting with lower case,
+// as do the leading initialisms like in HTTPGet or ID
+func tsMethodName(name string) string {
+	runes := []rune(name)
+	for i := range runes {
+		if !unicode.IsUpper(runes[i]) {
+			break
+		}
+		// the last upper case letter before a lower case one starts the next word
+		if i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+			break
+		}
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	name = string(runes)
+	if name == "constructor" || name == "baseURL" || name == "options" {
+		name += "_"
+	}
+
+	return name
+}
+
+// exportedName is the name starting with upper case
+func exportedName(name string) string {
+	if name == "" || token.IsExported(name) {
+		return name
+	}
+
+	return strings.ToUpper(name[:1]) + name[1:]
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTSNames(t *testing.T) {
+	methods := []struct {
+		Name     string
+		Expected string
+	}{
+		{"Profile", "profile"},
+		{"HTTPGet", "httpGet"},
+		{"ID", "id"},
+		{"GetID", "getID"},
+		{"Options", "options_"},
+	}
+	for _, item := range methods {
+		if got := tsMethodName(item.Name); got != item.Expected {
+			t.Errorf("[%s] method name not match\nGot: %s\nExpected: %s", item.Name, got, item.Expected)
+		}
+	}
+
+	properties := []struct {
+		Name     string
+		Expected string
+	}{
+		{"full_name", "full_name"},
+		{"user-id", `"user-id"`},
+		{"2fa", `"2fa"`},
+	}
+	for _, item := range properties {
+		if got := tsProperty(item.Name); got != item.Expected {
+			t.Errorf("[%s] property not match\nGot: %s\nExpected: %s", item.Name, got, item.Expected)
+		}
+	}
+
+	if got := tsAccess("params.inner?", "user-value"); got != `params.inner?.["user-value"]` {
+		t.Errorf("access not match\nGot: %s", got)
+	}
+	if got := tsArgName("class"); got != "_class" {
+		t.Errorf("arg name not match\nGot: %s", got)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// yamlMap is a YAML mapping keeping the order of its keys,
+// values are yamlMap, []interface{}, string, bool, int or yamlNumber
+type yamlMap []yamlItem
+
+type yamlItem struct {
+	Key   string
+	Value interface{}
+}
+
+// yamlNumber is a number written as is, like 10 or 0.5
+type yamlNumber string
+
+// set replaces the value of the key or appends it if the map has no such key
+func (m *yamlMap) set(key string, value interface{}) {
+	for i := range *m {
+		if (*m)[i].Key == key {
+			(*m)[i].Value = value
+			return
+		}
+	}
+	*m = append(*m, yamlItem{Key: key, Value: value})
+}
+
+func (m yamlMap) get(key string) interface{} {
+	for _, item := range m {
+		if item.Key == key {
+			return item.Value
+		}
+	}
+
+	return nil
+}
+
+// marshalYAML writes the value in the block style
+func marshalYAML(value interface{}) []byte {
+	var buf bytes.Buffer
+	writeYAML(&buf, value, 0)
+
+	return buf.Bytes()
+}
+
+func writeYAML(buf *bytes.Buffer, value interface{}, indent int) {
+	prefix := strings.Repeat("  ", indent)
+
+	switch value := value.(type) {
+	case yamlMap:
+		for _, item := range value {
+			buf.WriteString(prefix + yamlString(item.Key) + ":")
+			writeYAMLValue(buf, item.Value, indent+1)
+		}
+	case []interface{}:
+		for _, item := range value {
+			buf.WriteString(prefix + "-")
+			// the first key of a mapping goes on the line of the dash
+			if m, ok := item.(yamlMap); ok && len(m) != 0 {
+				var nested bytes.Buffer
+				writeYAML(&nested, m, indent+1)
+				buf.WriteString(" ")
+				buf.Write(nested.Bytes()[len(prefix)+2:])
+				continue
+			}
+			writeYAMLValue(buf, item, indent+1)
+		}
+	}
+}
+
+// writeYAMLValue writes the value following a key or a dash
+func writeYAMLValue(buf *bytes.Buffer, value interface{}, indent int) {
+	switch v := value.(type) {
+	case yamlMap:
+		if len(v) == 0 {
+			buf.WriteString(" {}\n")
+			return
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			buf.WriteString(" []\n")
+			return
+		}
+	default:
+		buf.WriteString(" " + yamlScalar(value) + "\n")
+		return
+	}
+
+	buf.WriteString("\n")
+	writeYAML(buf, value, indent)
+}
+
+func yamlScalar(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return yamlString(v)
+	case yamlNumber:
+		return string(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.Itoa(v)
+	}
+
+	panic(fmt.Sprintf("unsupported YAML value %T", value))
+}
+
+// yamlPlain matches strings which may be written without quotes,
+// anything else is written as a JSON string which is valid in YAML
+var yamlPlain = regexp.MustCompile(`^[a-zA-Z_/$][a-zA-Z0-9_ ./$+-]*$`)
+
+var yamlReserved = []string{"true", "false", "yes", "no", "on", "off", "null", "y", "n"}
+
+func yamlString(s string) string {
+	if !yamlPlain.MatchString(s) || strings.HasSuffix(s, " ") || contains(yamlReserved, strings.ToLower(s)) {
+		return strconv.Quote(s)
+	}
+
+	return s
+}
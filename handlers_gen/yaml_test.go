@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMarshalYAML(t *testing.T) {
+	doc := yamlMap{
+		{"openapi", "3.1.0"},
+		{"paths", yamlMap{
+			{"/user/{login}", yamlMap{
+				{"parameters", []interface{}{
+					yamlMap{{"name", "login"}, {"required", true}},
+					yamlMap{{"name", "yes"}, {"enum", []interface{}{"a: b", yamlNumber("0.5")}}},
+				}},
+				{"tags", []interface{}{}},
+			}},
+		}},
+		{"schemas", yamlMap{
+			{"200", yamlMap{}},
+			{"$ref", "#/components/schemas/User"},
+		}},
+	}
+
+	expected := `openapi: "3.1.0"
+paths:
+  "/user/{login}":
+    parameters:
+      - name: login
+        required: true
+      - name: "yes"
+        enum:
+          - "a: b"
+          - 0.5
+    tags: []
+schemas:
+  "200": {}
+  $ref: "#/components/schemas/User"
+`
+
+	if got := string(marshalYAML(doc)); got != expected {
+		t.Errorf("YAML not match\nGot:\n%s\nExpected:\n%s", got, expected)
+	}
+}
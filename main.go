@@ -7,12 +7,20 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"net/http"
+	"os"
 )
 
 func main() {
-	// будет вызван метод ServeHTTP у структуры MyApi
-	http.Handle("/user/", NewMyApi())
+	// обработчики с "auth": true сверяют X-Auth с этой переменной,
+	// без неё они отвечали бы 401 на любой запрос
+	if os.Getenv("API_AUTH_TOKEN") == "" {
+		log.Fatalln("API_AUTH_TOKEN is not set, run the server like API_AUTH_TOKEN=100500 go run .")
+	}
+
+	// роутер MyApi собирает обработчики методов один раз
+	http.Handle("/user/", NewMyApiRouter(NewMyApi()))
 
 	fmt.Println("starting server at :8080")
 	http.ListenAndServe(":8080", nil)
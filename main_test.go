@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"reflect"
 	"strings"
 	"testing"
@@ -24,9 +27,14 @@ type Case struct {
 	Method string // GET по-умолчанию в http.NewRequest если передали пустую строку
 	Path   string
 	Query  string
-	Auth   bool
-	Status int
-	Result interface{}
+	// Body отправляется вместо Query, если задан, с заголовком ContentType
+	Body        string
+	ContentType string
+	Auth        bool
+	Status      int
+	Result      interface{}
+	// Headers - ожидаемые заголовки ответа, если Result не задан - тело не проверяется
+	Headers map[string]string
 }
 
 const (
@@ -37,6 +45,12 @@ const (
 // CaseResponse
 type CR map[string]interface{}
 
+func TestMain(m *testing.M) {
+	// токен, который обработчики с "auth": true ждут в заголовке X-Auth
+	os.Setenv("API_AUTH_TOKEN", "100500")
+	os.Exit(m.Run())
+}
+
 func TestMyApi(t *testing.T) {
 	ts := httptest.NewServer(NewMyApi())
 
@@ -136,17 +150,28 @@ func TestMyApi(t *testing.T) {
 			Path:   ApiUserCreate,
 			Method: http.MethodGet,
 			Query:  "login=mr.moderator&age=32&status=moderator&full_name=GetMethod",
-			Status: http.StatusNotAcceptable,
+			Status: http.StatusMethodNotAllowed,
 			Auth:   true,
 			Result: CR{
 				"error": "bad method",
 			},
+			Headers: map[string]string{
+				"Allow": "POST, OPTIONS",
+			},
 		},
-		Case{
+		Case{ // OPTIONS отвечает списком разрешённых методов без авторизации
+			Path:   ApiUserCreate,
+			Method: http.MethodOptions,
+			Status: http.StatusNoContent,
+			Headers: map[string]string{
+				"Allow": "POST, OPTIONS",
+			},
+		},
+		Case{ // без учётных данных - 401, 403 остаётся для нехватки прав
 			Path:   ApiUserCreate,
 			Method: http.MethodPost,
 			Query:  "any_params=123",
-			Status: http.StatusForbidden,
+			Status: http.StatusUnauthorized,
 			Auth:   false,
 			Result: CR{
 				"error": "unauthorized",
@@ -212,6 +237,16 @@ func TestMyApi(t *testing.T) {
 				"error": "age must be <= 128",
 			},
 		},
+		Case{ // число не влезает в int - ошибка, а не переполнение
+			Path:   ApiUserCreate,
+			Method: http.MethodPost,
+			Query:  "login=new_moderator&age=99999999999999999999&status=moderator&full_name=Ivan_Ivanov",
+			Status: http.StatusBadRequest,
+			Auth:   true,
+			Result: CR{
+				"error": "age is out of int range",
+			},
+		},
 		Case{
 			Path:   ApiUserCreate,
 			Method: http.MethodPost,
@@ -285,6 +320,84 @@ func TestOtherApi(t *testing.T) {
 	runTests(t, ts, cases)
 }
 
+func TestMyApiJSON(t *testing.T) {
+	ts := httptest.NewServer(NewMyApi())
+
+	cases := []Case{
+		Case{ // создаём юзера, параметры в json
+			Path:        ApiUserCreate,
+			Method:      http.MethodPost,
+			Body:        `{"login": "mr.moderator", "age": 32, "status": "moderator", "name": "Ivan_Ivanov"}`,
+			ContentType: "application/json",
+			Status:      http.StatusOK,
+			Auth:        true,
+			Result: CR{
+				"error": "",
+				"response": CR{
+					"id": 43,
+				},
+			},
+		},
+		Case{ // валидация работает так же, как для формы
+			Path:        ApiUserCreate,
+			Method:      http.MethodPost,
+			Body:        `{"login": "new_m", "age": 32}`,
+			ContentType: "application/json; charset=utf-8",
+			Status:      http.StatusBadRequest,
+			Auth:        true,
+			Result: CR{
+				"error": "login len must be >= 10",
+			},
+		},
+		Case{
+			Path:        ApiUserCreate,
+			Method:      http.MethodPost,
+			Body:        `{"login": "new_moderator", "age": 256}`,
+			ContentType: "application/json",
+			Status:      http.StatusBadRequest,
+			Auth:        true,
+			Result: CR{
+				"error": "age must be <= 128",
+			},
+		},
+		Case{
+			Path:        ApiUserCreate,
+			Method:      http.MethodPost,
+			Body:        `{"login": "new_moderator",`,
+			ContentType: "application/json",
+			Status:      http.StatusBadRequest,
+			Auth:        true,
+			Result: CR{
+				"error": "bad json: unexpected EOF",
+			},
+		},
+		Case{
+			Path:        ApiUserCreate,
+			Method:      http.MethodPost,
+			Body:        `login=new_moderator`,
+			ContentType: "text/plain",
+			Status:      http.StatusUnsupportedMediaType,
+			Auth:        true,
+			Result: CR{
+				"error": "unsupported media type text/plain",
+			},
+		},
+		Case{
+			Path:        ApiUserCreate,
+			Method:      http.MethodPost,
+			Body:        `{"login": "` + strings.Repeat("a", 1<<20) + `"}`,
+			ContentType: "application/json",
+			Status:      http.StatusRequestEntityTooLarge,
+			Auth:        true,
+			Result: CR{
+				"error": "body must be <= 1048576 bytes",
+			},
+		},
+	}
+
+	runTests(t, ts, cases)
+}
+
 func runTests(t *testing.T, ts *httptest.Server, cases []Case) {
 	for idx, item := range cases {
 		var (
@@ -296,7 +409,10 @@ func runTests(t *testing.T, ts *httptest.Server, cases []Case) {
 
 		caseName := fmt.Sprintf("case %d: [%s] %s %s", idx, item.Method, item.Path, item.Query)
 
-		if item.Method == http.MethodPost {
+		if item.Body != "" {
+			req, err = http.NewRequest(item.Method, ts.URL+item.Path, strings.NewReader(item.Body))
+			req.Header.Add("Content-Type", item.ContentType)
+		} else if item.Method == http.MethodPost {
 			reqBody := strings.NewReader(item.Query)
 			req, err = http.NewRequest(item.Method, ts.URL+item.Path, reqBody)
 			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
@@ -323,6 +439,17 @@ func runTests(t *testing.T, ts *httptest.Server, cases []Case) {
 			continue
 		}
 
+		headersMatch := true
+		for header, value := range item.Headers {
+			if got := resp.Header.Get(header); got != value {
+				t.Errorf("[%s] expected header %s: %q, got %q", caseName, header, value, got)
+				headersMatch = false
+			}
+		}
+		if !headersMatch || item.Result == nil {
+			continue
+		}
+
 		err = json.Unmarshal(body, &result)
 		if err != nil {
 			t.Errorf("[%s] cant unpack json: %v", caseName, err)
@@ -342,3 +469,80 @@ func runTests(t *testing.T, ts *httptest.Server, cases []Case) {
 		}
 	}
 }
+
+func TestMyApiMiddleware(t *testing.T) {
+	var calls []string
+	trace := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	router := NewMyApiRouter(NewMyApi())
+	router.Use(trace("first"), trace("second"))
+	router.Use(trace("third"))
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	resp, err := client.Get(ts.URL + ApiUserProfile + "?login=rvasily")
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected http status %v, got %v", http.StatusOK, resp.StatusCode)
+	}
+	// middleware вызываются в порядке добавления
+	expected := []string{"first", "second", "third"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("middleware calls not match\nGot: %v\nExpected: %v", calls, expected)
+	}
+}
+
+func TestMyApiPanic(t *testing.T) {
+	// у nil-сервиса нет хранилища пользователей, Profile паникует
+	var srv *MyApi
+	ts := httptest.NewServer(http.HandlerFunc(srv.ProfileWrapper))
+	defer ts.Close()
+
+	resp, err := client.Get(ts.URL + ApiUserProfile + "?login=rvasily")
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected http status %v, got %v", http.StatusInternalServerError, resp.StatusCode)
+	}
+
+	var result CR
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("cant unpack json: %v", err)
+	}
+	if result["error"] != "runtime error: invalid memory address or nil pointer dereference" {
+		t.Errorf("unexpected error %v", result["error"])
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	cases := []struct {
+		Err    error
+		Status int
+	}{
+		{ApiError{http.StatusNotFound, errors.New("user not exist")}, http.StatusNotFound},
+		{fmt.Errorf("wrapped: %w", ApiError{http.StatusConflict, errors.New("exists")}), http.StatusConflict},
+		{fmt.Errorf("db: %w", context.Canceled), 499},
+		{fmt.Errorf("db: %w", context.DeadlineExceeded), http.StatusGatewayTimeout},
+		{errors.New("bad user"), http.StatusInternalServerError},
+	}
+
+	for _, item := range cases {
+		if status := errorStatus(item.Err); status != item.Status {
+			t.Errorf("[%v] expected http status %v, got %v", item.Err, item.Status, status)
+		}
+	}
+}